@@ -0,0 +1,58 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 20:55
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package auth
+
+import (
+	"fmt"
+	"path"
+	"sync"
+)
+
+// AnyPrincipal 匹配所有通过认证的调用方
+const AnyPrincipal = "*"
+
+type rule struct {
+	principal string
+	patterns  []string
+}
+
+// ACL 调用方到Service.Method的访问控制 没有匹配的规则时拒绝
+// 方法的模式使用path.Match的语法 例如 "Foo.*" 或者 "*.Get*"
+type ACL struct {
+	mu    sync.RWMutex
+	rules []rule
+}
+
+func NewACL() *ACL {
+	return &ACL{}
+}
+
+// Allow 允许principal调用匹配patterns的方法 principal为AnyPrincipal时对所有调用方生效
+func (a *ACL) Allow(principal string, patterns ...string) *ACL {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = append(a.rules, rule{principal: principal, patterns: patterns})
+	return a
+}
+
+// Check 检查principal能否调用serviceMethod 不允许时返回的错误包含ErrPermissionDenied
+func (a *ACL) Check(principal, serviceMethod string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, r := range a.rules {
+		if r.principal != AnyPrincipal && r.principal != principal {
+			continue
+		}
+		for _, pattern := range r.patterns {
+			if ok, _ := path.Match(pattern, serviceMethod); ok {
+				return nil
+			}
+		}
+	}
+	return withReason(ErrPermissionDenied, fmt.Sprintf("%q cannot call %s", principal, serviceMethod))
+}
@@ -0,0 +1,167 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 20:40
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"rpc/status"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnauthenticated  error = status.New(status.Unauthenticated, "rpc auth: unauthenticated")
+	ErrPermissionDenied error = status.New(status.PermissionDenied, "rpc auth: permission denied")
+)
+
+// Credentials 客户端提供的凭证
+type Credentials struct {
+	Token string               // 握手时option中的token 或者请求header中的token
+	TLS   *tls.ConnectionState // TLS连接的状态 明文连接时为nil
+}
+
+// Authenticator 校验凭证 返回调用方的身份 校验失败时返回的错误包含ErrUnauthenticated
+type Authenticator interface {
+	Authenticate(cred *Credentials) (principal string, err error)
+}
+
+// AuthenticatorFunc 把函数转换成Authenticator
+type AuthenticatorFunc func(cred *Credentials) (string, error)
+
+func (f AuthenticatorFunc) Authenticate(cred *Credentials) (string, error) {
+	return f(cred)
+}
+
+// Reason 认证或者鉴权失败的具体原因 放在状态的Details中
+// 错误信息和ErrUnauthenticated ErrPermissionDenied保持一致 客户端收到后仍然可以用errors.Is判断
+type Reason struct {
+	Reason string
+}
+
+// withReason 在预先定义的错误上附加原因
+func withReason(err error, reason string) error {
+	st, _ := err.(*status.Status).WithDetails(Reason{Reason: reason})
+	return st
+}
+
+// ReasonOf 取出错误中附加的原因 没有时返回空字符串
+func ReasonOf(err error) string {
+	var r Reason
+	if st, ok := status.FromError(err); ok && st.Detail(&r) {
+		return r.Reason
+	}
+	return ""
+}
+
+func unauthenticated(reason string) error {
+	return withReason(ErrUnauthenticated, reason)
+}
+
+// StaticTokens 固定的bearer token tokens是token到身份的映射
+func StaticTokens(tokens map[string]string) Authenticator {
+	return AuthenticatorFunc(func(cred *Credentials) (string, error) {
+		if cred.Token == "" {
+			return "", unauthenticated("missing token")
+		}
+		for token, principal := range tokens {
+			if hmac.Equal([]byte(token), []byte(cred.Token)) {
+				return principal, nil
+			}
+		}
+		return "", unauthenticated("invalid token")
+	})
+}
+
+// SignToken 用secret为principal签发一个在expire之前有效的token
+// token的格式为 principal.过期时间.签名
+func SignToken(secret []byte, principal string, expire time.Time) string {
+	payload := principal + "." + strconv.FormatInt(expire.Unix(), 10)
+	return payload + "." + sign(secret, payload)
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HMAC 校验SignToken签发的token
+func HMAC(secret []byte) Authenticator {
+	return AuthenticatorFunc(func(cred *Credentials) (string, error) {
+		if cred.Token == "" {
+			return "", unauthenticated("missing token")
+		}
+		// principal中可能有点号 从后往前拆分
+		i := strings.LastIndex(cred.Token, ".")
+		if i < 0 {
+			return "", unauthenticated("malformed token")
+		}
+		payload, signature := cred.Token[:i], cred.Token[i+1:]
+		if !hmac.Equal([]byte(sign(secret, payload)), []byte(signature)) {
+			return "", unauthenticated("invalid token signature")
+		}
+		j := strings.LastIndex(payload, ".")
+		if j < 0 {
+			return "", unauthenticated("malformed token")
+		}
+		expire, err := strconv.ParseInt(payload[j+1:], 10, 64)
+		if err != nil {
+			return "", unauthenticated("malformed token")
+		}
+		if time.Now().Unix() >= expire {
+			return "", unauthenticated("token expired")
+		}
+		return payload[:j], nil
+	})
+}
+
+// MTLS 使用客户端证书的CommonName作为身份 证书需要已经被服务端校验过
+func MTLS() Authenticator {
+	return AuthenticatorFunc(func(cred *Credentials) (string, error) {
+		if cred.TLS == nil || len(cred.TLS.VerifiedChains) == 0 || len(cred.TLS.PeerCertificates) == 0 {
+			return "", unauthenticated("missing verified client certificate")
+		}
+		cn := cred.TLS.PeerCertificates[0].Subject.CommonName
+		if cn == "" {
+			return "", unauthenticated("client certificate has no common name")
+		}
+		return cn, nil
+	})
+}
+
+// Any 依次尝试多个Authenticator 返回第一个成功的身份 全部失败时返回最后一个错误
+func Any(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(cred *Credentials) (string, error) {
+		err := unauthenticated("no authenticator")
+		for _, a := range authenticators {
+			var principal string
+			if principal, err = a.Authenticate(cred); err == nil {
+				return principal, nil
+			}
+		}
+		return "", err
+	})
+}
+
+type tokenKey struct{}
+
+// WithToken 为这个context中发起的调用附带token 放在请求header中发给服务端
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext 取出WithToken设置的token
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token
+}
@@ -0,0 +1,45 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 21:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	secret := []byte("secret")
+	a := HMAC(secret)
+	principal, err := a.Authenticate(&Credentials{Token: SignToken(secret, "svc.billing", time.Now().Add(time.Minute))})
+	_assert(err == nil && principal == "svc.billing", "valid token rejected: %v", err)
+
+	_, err = a.Authenticate(&Credentials{Token: SignToken([]byte("other"), "svc.billing", time.Now().Add(time.Minute))})
+	_assert(errors.Is(err, ErrUnauthenticated), "expect bad signature, got %v", err)
+	_, err = a.Authenticate(&Credentials{Token: SignToken(secret, "svc.billing", time.Now().Add(-time.Minute))})
+	_assert(errors.Is(err, ErrUnauthenticated) && ReasonOf(err) == "token expired", "expect expired token, got %v", err)
+
+	// 任意一个成功即可
+	principal, err = Any(StaticTokens(map[string]string{"t1": "alice"}), a).Authenticate(&Credentials{Token: "t1"})
+	_assert(err == nil && principal == "alice", "static token rejected: %v", err)
+}
+
+func TestACL(t *testing.T) {
+	acl := NewACL().Allow("alice", "Foo.*").Allow(AnyPrincipal, "Health.Check")
+	_assert(acl.Check("alice", "Foo.Sum") == nil, "alice should call Foo.Sum")
+	_assert(acl.Check("bob", "Health.Check") == nil, "everyone should call Health.Check")
+	err := acl.Check("bob", "Foo.Sum")
+	_assert(errors.Is(err, ErrPermissionDenied), "expect permission denied, got %v", err)
+}
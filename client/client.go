@@ -10,15 +10,19 @@ package client
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"rpc/auth"
 	"rpc/codec"
 	"rpc/logger"
+	"rpc/metadata"
 	"rpc/option"
+	"rpc/status"
 	"strings"
 	"sync"
 	"time"
@@ -41,8 +45,17 @@ type Client struct {
 	sending  *sync.Mutex      // 发消息锁
 	Closing  bool             // 用户主动关闭
 	ShutDown bool             // 处理出现错误关闭
+	invoke   option.Invoker   // 经过拦截器包装之后的调用函数
+	draining bool             // 服务端正在关闭
+	done     chan struct{}    // 接收协程退出时关闭
 }
 
+// Interceptor 客户端拦截器 通过option.Option.Interceptors在建立连接时配置
+type Interceptor = option.Interceptor
+
+// Invoker 拦截器中继续发起调用的函数
+type Invoker = option.Invoker
+
 func (c *Client) IsValid() bool {
 	if c.ShutDown == false && c.Closing == false {
 		return true
@@ -50,7 +63,21 @@ func (c *Client) IsValid() bool {
 	return false
 }
 
-var ErrShutdown = errors.New("the conn is closed")
+// Outstanding 还没有完成的调用数 包括正在进行的流
+func (c *Client) Outstanding() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.Pending)
+}
+
+// Draining 服务端是否通知了正在关闭 这时不应该再发送新的请求
+func (c *Client) Draining() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.draining
+}
+
+var ErrShutdown error = status.New(status.Unavailable, "the conn is closed")
 
 func (c *Client) Close() error {
 	if c.ShutDown == true || c.Closing == true {
@@ -75,6 +102,23 @@ func (c *Client) send(call *Call) {
 	c.header.Seq = seq
 	c.header.ServiceMethod = call.ServiceMethod
 	c.header.Err = ""
+	c.header.Flags = 0
+	c.header.StreamID = 0
+	if call.stream != nil {
+		// 打开流的请求 之后这个流的消息都使用这个Seq作为StreamID
+		c.header.Flags = codec.FlagStreamData
+		c.header.StreamID = seq
+	}
+	c.header.Timeout = 0
+	c.header.Auth = auth.TokenFromContext(call.ctx)
+	c.header.Metadata, _ = metadata.FromOutgoingContext(call.ctx)
+	// 把剩余的超时时间告诉服务端 服务端到时间后会取消处理
+	if deadline, ok := call.ctx.Deadline(); ok {
+		c.header.Timeout = time.Until(deadline)
+		if c.header.Timeout <= 0 {
+			c.header.Timeout = time.Nanosecond
+		}
+	}
 	// 如果写失败的话 call为什么会变nil？ 假如header写入成功并被读取成功 那么call会被删除 但是
 	// 参数写入失败的话这里报错err 这个时候call已经被删除了
 	// 但是为什么不把call写在后面呢？ 前面只写一个getCall函数 在读取了body之后再删除
@@ -96,19 +140,49 @@ func (c *Client) receive() {
 		if err = c.Codec.ReadHeader(&header); err != nil {
 			break
 		}
+		if header.Flags&codec.FlagDrain != 0 {
+			// 服务端正在关闭 已经发出的请求还会正常返回
+			c.mu.Lock()
+			c.draining = true
+			c.mu.Unlock()
+			err = c.Codec.ReadBody(nil)
+			continue
+		}
+		if header.Flags&codec.FlagWindowUpdate != 0 {
+			err = c.receiveWindow(&header)
+			continue
+		}
+		if header.Flags&codec.FlagStreamData != 0 && header.Flags&codec.FlagStreamClose == 0 {
+			// 流中的消息 流还没有结束 不能删除call
+			err = c.receiveStream(&header)
+			continue
+		}
 		// 删除是表示已经处理完毕的call调用
 		call := c.removeCall(header.Seq)
+		// 服务端返回的错误都带有错误码 旧版本的服务端没有错误码时是Unknown
+		st := status.FromHeader(&header)
+		if call != nil {
+			call.Trailer = header.Metadata
+		}
 		switch {
 		case call == nil:
 			// 原因是因为调用已经被删除了
 			logger.Logger.Println("call is empty")
 			// FIXME 即使错误也要把后面的数据读出来 为什么？
 			err = c.Codec.ReadBody(nil)
-		case c.header.Err != "":
-			// FIXME 我为啥加了这一行 傻逼了？
-			//call.Reply = errors.New(header.Err)
+		case call.stream != nil:
+			// 流结束
+			err = c.Codec.ReadBody(nil)
+			if st != nil {
+				call.Err = st
+				call.stream.finish(st)
+			} else {
+				call.stream.finish(io.EOF)
+			}
+			call.Done()
+		case st != nil:
 			// 即使错误也要把后面的数据读出来 为什么？
-			call.Err = fmt.Errorf(header.Err)
+			call.Err = st
 			err = c.Codec.ReadBody(nil)
 			// pending中已经删除了 这里还Done有什么意义？
 			call.Done()
@@ -116,16 +190,30 @@ func (c *Client) receive() {
 			err = c.Codec.ReadBody(call.Reply)
 			if err != nil {
 				call.Err = err
+				// 帧模式下body解析失败只影响当前调用
+				if codec.IsBodyError(err) {
+					err = nil
+				}
 			}
 			call.Done()
 		}
 	}
 	// 需不需要加入关闭连接？
 	c.terminateCalls(err)
+	close(c.done)
+}
+
+// Done 连接断开并且所有调用都结束之后关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.done
 }
 
 // Go 再添加一个同步请求
 func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return c.goContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+func (c *Client) goContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
@@ -136,22 +224,55 @@ func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Ca
 		Args:          args,
 		Reply:         reply,
 		done:          done,
+		ctx:           ctx,
 	}
 	c.send(call)
 	return call
 }
 
+// Call 同步调用 会依次经过option中配置的拦截器
 func (c *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if c.invoke == nil {
+		return c.call(ctx, serviceMethod, args, reply)
+	}
+	return c.invoke(ctx, serviceMethod, args, reply)
+}
+
+func (c *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
 	// 根据传入的参数生成一个调用call 再把call发送过去
-	call := c.Go(serviceMethod, args, reply, make(chan *Call, 1)).done
+	call := c.goContext(ctx, serviceMethod, args, reply, make(chan *Call, 1))
 	select {
-	case call := <-call:
+	case call := <-call.done:
+		if md := metadata.TrailerTarget(ctx); md != nil {
+			*md = call.Trailer
+		}
 		return call.Err
 	case <-ctx.Done():
-		return errors.New("rpc client: call failed: " + ctx.Err().Error())
+		c.cancel(call)
+		return fmt.Errorf("rpc client: call failed: %w", ctx.Err())
 	}
 }
 
+// cancel 删除还没有完成的调用 并通知服务端取消处理
+func (c *Client) cancel(call *Call) {
+	if c.removeCall(call.Seq) == nil {
+		// 调用已经完成或者没有发送出去
+		return
+	}
+	if !option.HasFeature(c.Opt.Features, option.FeatureCancel) {
+		return
+	}
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	header := codec.Header{ServiceMethod: call.ServiceMethod, Seq: call.Seq, Flags: codec.FlagCancel}
+	if err := c.Codec.Write(&header, invalidRequest); err != nil {
+		logger.Logger.Println("rpc client: send cancel fail,err:", err)
+	}
+}
+
+// invalidRequest 取消请求时的body
+var invalidRequest = struct{}{}
+
 type clientResult struct {
 	client *Client
 	err    error
@@ -165,6 +286,8 @@ func DialHTTP(network, address string, opts ...*option.Option) (*Client, error)
 	return dialTimeout(NewHTTPClient, network, address, opts...)
 }
 
+// XDial 根据protocol@addr的格式连接 例如 tcp@127.0.0.1:9999 tls@127.0.0.1:9999 http@127.0.0.1:9999
+// 使用tls协议时需要在option中配置TLSConfig
 func XDial(rpcAddr string, opts ...*option.Option) (*Client, error) {
 	r := strings.Split(rpcAddr, "@")
 	if len(r) != 2 {
@@ -180,15 +303,59 @@ func XDial(rpcAddr string, opts ...*option.Option) (*Client, error) {
 	}
 }
 
+// errNoHandshake 等待握手应答超时 服务端可能还没有升级
+var errNoHandshake = errors.New("rpc client: no handshake reply")
+
+// legacyTTL 没有回复握手的服务端在这段时间内直接使用旧版本的协议连接 之后重新尝试握手
+var legacyTTL = time.Minute
+
+// legacyServers 没有回复握手的服务端 protocol@addr到发现时间的映射
+var legacyServers sync.Map
+
+func isLegacyServer(key string) bool {
+	v, ok := legacyServers.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Since(v.(time.Time)) < legacyTTL {
+		return true
+	}
+	legacyServers.Delete(key)
+	return false
+}
+
+// legacyOption 不等待握手应答的option 只能使用双方事先约定的编码方式
+func legacyOption(opt *option.Option) *option.Option {
+	o := *opt
+	o.Version = option.LegacyVersion
+	return &o
+}
+
 // dialTimeout 客户端发起请求 这个函数很奇怪 个人感觉应该绑定在Client结构体上才对
 // 新增处理连接超时
+// 滚动升级时服务端可能还没有升级 收不到握手应答时换成旧版本的协议重新连接
 func dialTimeout(newClient NewClient, network, address string, opts ...*option.Option) (*Client, error) {
 	opt := parseOptions(opts...)
 	if opt == nil {
 		logger.Logger.Println("parse opts fail")
 		return nil, errors.New("parse opts fail")
 	}
-	conn, err := net.DialTimeout(network, address, opt.ConnectTimeOut)
+	key := network + "@" + address
+	if !opt.Legacy() && isLegacyServer(key) {
+		opt = legacyOption(opt)
+	}
+	client, err := dialOnce(newClient, network, address, opt)
+	if errors.Is(err, errNoHandshake) {
+		logger.Logger.Println("rpc client:", address, "did not reply the handshake, fall back to legacy version")
+		legacyServers.Store(key, time.Now())
+		return dialOnce(newClient, network, address, legacyOption(opt))
+	}
+	return client, err
+}
+
+// dialOnce 建立一次连接 连接超时包括等待握手应答的时间
+func dialOnce(newClient NewClient, network, address string, opt *option.Option) (*Client, error) {
+	conn, err := dialConn(network, address, opt)
 	if err != nil {
 		logger.Logger.Println("dail to server fail:err:", err)
 		return nil, err
@@ -218,10 +385,26 @@ func dialTimeout(newClient NewClient, network, address string, opts ...*option.O
 	}
 }
 
+// dialConn 建立连接 option中配置了TLSConfig时使用TLS 握手也计入连接超时
+// network为tls时必须配置TLSConfig
+func dialConn(network, address string, opt *option.Option) (net.Conn, error) {
+	if network == "tls" {
+		if opt.TLSConfig == nil {
+			return nil, option.ErrTLSConfigRequired
+		}
+		network = "tcp"
+	}
+	if opt.TLSConfig == nil {
+		return net.DialTimeout(network, address, opt.ConnectTimeOut)
+	}
+	dialer := &net.Dialer{Timeout: opt.ConnectTimeOut}
+	return tls.DialWithDialer(dialer, network, address, opt.TLSConfig)
+}
+
 type NewClient func(conn net.Conn, opt *option.Option) (*Client, error)
 
 func NewGobClient(conn net.Conn, opt *option.Option) (*Client, error) {
-	f := codec.NewCodecFuncMap[opt.CodecType]
+	f := opt.NewCodecFunc()
 	if f == nil {
 		logger.Logger.Println("UnSupported Codec Type")
 		return nil, errors.New("UnSupported Codec Type")
@@ -232,6 +415,15 @@ func NewGobClient(conn net.Conn, opt *option.Option) (*Client, error) {
 		_ = conn.Close()
 		return nil, errors.New("EnCode opt fail")
 	}
+	if !opt.Legacy() {
+		// 等待服务端的握手应答 之后使用双方协商后的选项
+		conn, opt, err = readHandshake(conn, opt)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		f = opt.NewCodecFunc()
+	}
 	client := &Client{
 		Codec:    f(conn),
 		Seq:      0,
@@ -241,23 +433,54 @@ func NewGobClient(conn net.Conn, opt *option.Option) (*Client, error) {
 		sending:  new(sync.Mutex),
 		Closing:  false,
 		ShutDown: false,
+		done:     make(chan struct{}),
+	}
+	if len(opt.Interceptors) > 0 {
+		client.invoke = option.ChainInterceptors(opt.Interceptors, client.call)
 	}
 	go client.receive()
 	return client, nil
 }
 
-func NewJsonClient(conn net.Conn, opt *option.Option) *Client {
-	f := codec.NewCodecFuncMap[codec.JsonType]
-	return &Client{
-		Codec:    f(conn),
-		Seq:      0,
-		Pending:  make(map[uint64]*Call, 10),
-		Opt:      opt,
-		mu:       new(sync.Mutex),
-		sending:  new(sync.Mutex),
-		Closing:  false,
-		ShutDown: false,
+// handshakeTimeout 等待握手应答的时间 最多用掉一半的连接超时 超时后还来得及用旧版本的协议重连
+func handshakeTimeout(opt *option.Option) time.Duration {
+	timeout := option.HandshakeTimeout
+	if opt.ConnectTimeOut > 0 && timeout > opt.ConnectTimeOut/2 {
+		timeout = opt.ConnectTimeOut / 2
+	}
+	return timeout
+}
+
+// readHandshake 读取服务端的握手应答 没有设置连接超时时也不会一直等待
+func readHandshake(conn net.Conn, opt *option.Option) (net.Conn, *option.Option, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout(opt)))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	decoder := json.NewDecoder(conn)
+	var hs option.Handshake
+	if err := decoder.Decode(&hs); err != nil {
+		logger.Logger.Println("read handshake fail,err:", err)
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return conn, nil, fmt.Errorf("%w: %v", errNoHandshake, err)
+		}
+		return conn, nil, err
+	}
+	if hs.Err != "" {
+		return conn, nil, &option.HandshakeError{Reason: hs.Err}
+	}
+	negotiated := hs.Apply(opt)
+	if hs.Version > opt.Version || negotiated.NewCodecFunc() == nil ||
+		hs.FrameMode && !option.HasFeature(hs.Features, option.FeatureFrame) {
+		return conn, nil, &option.HandshakeError{Reason: fmt.Sprintf("unexpected handshake %+v", hs)}
 	}
+	return codec.NewBufferedConn(conn, decoder.Buffered()), negotiated, nil
+}
+
+// NewJsonClient 使用json编码器的客户端 编码方式通过option协商给服务端
+func NewJsonClient(conn net.Conn, opt *option.Option) (*Client, error) {
+	jsonOpt := *opt
+	jsonOpt.CodecType = codec.JsonType
+	return NewGobClient(conn, &jsonOpt)
 }
 
 func NewHTTPClient(conn net.Conn, opt *option.Option) (*Client, error) {
@@ -277,19 +500,34 @@ func NewHTTPClient(conn net.Conn, opt *option.Option) (*Client, error) {
 	return nil, errors.New("unexpected HTTP response:" + response.Status)
 }
 
+// parseOptions 返回填充了默认值的副本 不修改调用方传入的option和共享的默认值
 func parseOptions(opts ...*option.Option) *option.Option {
 	if len(opts) == 0 || opts[0] == nil {
-		return option.DefaultOption
+		opts = []*option.Option{option.DefaultOption}
 	}
 	if len(opts) != 1 {
 		logger.Logger.Println("option num is more than one")
 		return nil
 	}
-	opt := opts[0]
+	o := *opts[0]
+	opt := &o
 	opt.MagicNumber = option.MagicNumber
 	if opt.CodecType == "" {
 		opt.CodecType = codec.GobType
 	}
+	if opt.Version == 0 {
+		opt.Version = option.ProtocolVersion
+	}
+	if opt.Features == nil {
+		opt.Features = option.DefaultFeatures
+	}
+	opt.Features = append([]string(nil), opt.Features...)
+	if opt.FrameMode && !option.HasFeature(opt.Features, option.FeatureFrame) {
+		// 帧模式需要在握手时协商
+		opt.Features = append(opt.Features, option.FeatureFrame)
+	}
+	opt.Codecs = append([]string(nil), opt.Codecs...)
+	opt.Compressors = append([]string(nil), opt.Compressors...)
 	return opt
 }
 
@@ -299,7 +537,7 @@ func (c *Client) registerCall(call *Call) (uint64, error) {
 	defer c.mu.Unlock()
 	if !c.IsValid() {
 		logger.Logger.Println("register fail,the conn is closed")
-		return 0, errors.New("register fail,the conn is closed")
+		return 0, status.New(status.Unavailable, "register fail,the conn is closed")
 	}
 	call.Seq = c.Seq
 	c.Pending[c.Seq] = call
@@ -307,6 +545,18 @@ func (c *Client) registerCall(call *Call) (uint64, error) {
 	return call.Seq, nil
 }
 
+// nextSeq 流中的后续消息不需要注册调用 只占用一个序列号
+func (c *Client) nextSeq() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.IsValid() {
+		return 0, ErrShutdown
+	}
+	seq := c.Seq
+	c.Seq++
+	return seq, nil
+}
+
 // 返回调用有什么用？
 func (c *Client) removeCall(seq uint64) *Call {
 	c.mu.Lock()
@@ -327,6 +577,14 @@ func (c *Client) terminateCalls(err error) {
 	for _, call := range c.Pending {
 		// 将错误发给所有的调用
 		call.Err = err
+		if call.stream != nil {
+			// 连接断开不是流的正常结束
+			if err == io.EOF {
+				call.stream.finish(io.ErrUnexpectedEOF)
+			} else {
+				call.stream.finish(err)
+			}
+		}
 		call.Done()
 	}
 }
@@ -339,6 +597,9 @@ type Call struct {
 	done          chan *Call  // 调用管道 如果调用完成的话，将自己放入管道中去
 	Err           error       // 记录调用过程中的错误
 	Reply         interface{} // 调用返回值
+	ctx           context.Context
+	stream        *Stream     // 流式调用对应的流
+	Trailer       metadata.MD // 服务端返回的trailer 调用完成后才有
 }
 
 func (c *Call) Done() {
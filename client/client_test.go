@@ -8,32 +8,542 @@
 package client
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"os"
+	"rpc/codec"
+	"rpc/flow"
+	"rpc/option"
 	"rpc/server"
+	"rpc/status"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// canceled Num2为负数时 服务端的处理被取消后写入取消原因
+var canceled = make(chan error, 10)
+
+// Sleep 睡眠Num1毫秒 服务端取消时提前返回
+func (f Foo) Sleep(ctx context.Context, args Args, reply *int) error {
+	select {
+	case <-time.After(time.Duration(args.Num1) * time.Millisecond):
+	case <-ctx.Done():
+		if args.Num2 < 0 {
+			canceled <- ctx.Err()
+		}
+		return ctx.Err()
+	}
+	info, _ := server.CallInfoFromContext(ctx)
+	if info == nil || info.ServiceMethod != "Foo.Sleep" {
+		return errors.New("missing call info")
+	}
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Count 依次发送0到Num1-1 Num2为负数时最后返回错误
+func (f Foo) Count(args Args, stream server.Stream) error {
+	for i := 0; i < args.Num1; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	if args.Num2 < 0 {
+		return errors.New("count failed")
+	}
+	return nil
+}
+
+// Echo 对客户端发来的每条消息回复Num1+Num2 客户端关闭发送后结束
+func (f Foo) Echo(args Args, stream server.Stream) error {
+	for {
+		if err := stream.Send(args.Num1 + args.Num2); err != nil {
+			return err
+		}
+		if err := stream.Recv(&args); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func startServer(t *testing.T) string {
+	var foo Foo
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen tcp")
+	}
+	s := server.NewServer()
+	s.RegisterService(&foo)
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
 func TestXDial(t *testing.T) {
 	if runtime.GOOS == "linux" {
-		ch := make(chan struct{})
 		addr := "/tmp/geerpc.sock"
-		go func() {
-			_ = os.Remove(addr)
-			l, err := net.Listen("unix", addr)
+		_ = os.Remove(addr)
+		l, err := net.Listen("unix", addr)
+		if err != nil {
+			t.Fatal("failed to listen unix socket")
+		}
+		go server.Accept(l)
+		_, err = XDial("unix@" + addr)
+		_assert(err == nil, "failed to connect unix socket")
+	}
+}
+
+func TestJsonClient(t *testing.T) {
+	addr := startServer(t)
+	opt := &option.Option{CodecType: codec.JsonType}
+	cli, err := Dial("tcp", addr, opt)
+	_assert(err == nil, "failed to dial with json codec: %v", err)
+	defer func() { _ = cli.Close() }()
+	// 默认值填在副本上 调用方的option保持不变
+	_assert(opt.MagicNumber == 0 && opt.Version == 0 && opt.Features == nil, "caller's option was modified: %+v", opt)
+	var reply int
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call Foo.Sum with json codec: %v", err)
+	err = cli.Call(context.Background(), "Foo.Nope", &Args{}, &reply)
+	_assert(err != nil, "expect an error for unknown method")
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 2, Num2: 2}, &reply)
+	_assert(err == nil && reply == 4, "conn should be usable after an error: %v", err)
+}
+
+func TestFrameMode(t *testing.T) {
+	addr := startServer(t)
+	for _, typ := range []string{codec.GobType, codec.JsonType} {
+		cli, err := Dial("tcp", addr, &option.Option{CodecType: typ, FrameMode: true})
+		_assert(err == nil && cli.Opt.FrameMode, "failed to dial in frame mode: %v", err)
+		var reply int
+		err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "failed to call Foo.Sum in frame mode: %v", err)
+		err = cli.Call(context.Background(), "Foo.Sum", "bad args", &reply)
+		_assert(err != nil, "expect an error for bad args")
+		err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 2, Num2: 2}, &reply)
+		_assert(err == nil && reply == 4, "conn should be usable after a bad body: %v", err)
+		_ = cli.Close()
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	addr := startServer(t)
+	cli, err := Dial("tcp", addr, &option.Option{Codecs: []string{"XmlType", codec.JsonType}, Features: []string{option.FeatureFrame}})
+	_assert(err == nil && cli.Opt.CodecType == codec.JsonType, "failed to negotiate codec: %v", err)
+	_assert(option.HasFeature(cli.Opt.Features, option.FeatureFrame) && cli.Opt.FrameMode, "frame mode should follow the negotiated features")
+	_ = cli.Close()
+
+	_, err = Dial("tcp", addr, &option.Option{Codecs: []string{"XmlType"}})
+	var hsErr *option.HandshakeError
+	_assert(errors.As(err, &hsErr), "expect a handshake error, got %v", err)
+
+	// 旧版本的客户端不等待握手应答
+	cli, err = Dial("tcp", addr, &option.Option{Version: option.LegacyVersion})
+	_assert(err == nil, "failed to dial with legacy version: %v", err)
+	var reply int
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call Foo.Sum with legacy version: %v", err)
+	_ = cli.Close()
+
+	// 还没有升级的服务端不回复握手 等待超时后用旧版本的协议重新连接
+	old := option.HandshakeTimeout
+	option.HandshakeTimeout = 100 * time.Millisecond
+	defer func() { option.HandshakeTimeout = old }()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp: %v", err)
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
 			if err != nil {
-				t.Fatal("failed to listen unix socket")
+				return
 			}
-			ch <- struct{}{}
-			server.Accept(l)
-		}()
-		<-ch
-		_, err := XDial("unix@" + addr)
-		_assert(err == nil, "failed to connect unix socket")
+			go serveLegacy(conn)
+		}
+	}()
+	start := time.Now()
+	cli, err = Dial("tcp", l.Addr().String())
+	_assert(err == nil && cli.Opt.Legacy() && time.Since(start) < time.Second, "dial should fall back to legacy version: %v", err)
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call a legacy server: %v", err)
+	_ = cli.Close()
+	// 之后的连接直接使用旧版本的协议 不再等待握手应答
+	start = time.Now()
+	cli, err = Dial("tcp", l.Addr().String())
+	_assert(err == nil && cli.Opt.Legacy() && time.Since(start) < option.HandshakeTimeout, "dial should remember the legacy server: %v", err)
+	_ = cli.Close()
+}
+
+// serveLegacy 模拟还没有升级的服务端 读取option之后直接处理Foo.Sum 不回复握手
+func serveLegacy(conn net.Conn) {
+	decoder := json.NewDecoder(conn)
+	var opt option.Option
+	if err := decoder.Decode(&opt); err != nil {
+		_ = conn.Close()
+		return
+	}
+	c := codec.NewGobCodec(codec.NewBufferedConn(conn, decoder.Buffered()))
+	defer func() { _ = c.Close() }()
+	for {
+		var h codec.Header
+		var args Args
+		if c.ReadHeader(&h) != nil || c.ReadBody(&args) != nil {
+			return
+		}
+		if c.Write(&h, args.Num1+args.Num2) != nil {
+			return
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	addr := startServer(t)
+	cli, err := Dial("tcp", addr, &option.Option{Compressors: []string{"snappy", codec.Gzip}, CompressThreshold: 1})
+	_assert(err == nil && cli.Opt.Compress() == codec.Gzip, "failed to negotiate compressor: %v", err)
+	var reply int
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call Foo.Sum with compression: %v", err)
+	_ = cli.Close()
+
+	// 旧版本的连接收不到握手应答 不会压缩
+	cli, err = Dial("tcp", addr, &option.Option{Version: option.LegacyVersion, Compressors: []string{codec.Gzip}, CompressThreshold: 1})
+	_assert(err == nil && cli.Opt.Compress() == "", "legacy conn should not compress: %v", err)
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call Foo.Sum on a legacy conn: %v", err)
+	_ = cli.Close()
+}
+
+func TestHandleTimeout(t *testing.T) {
+	addr := startServer(t)
+	cli, err := Dial("tcp", addr, &option.Option{HandleTimeOut: 50 * time.Millisecond})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = cli.Close() }()
+	var reply int
+	err = cli.Call(context.Background(), "Foo.Sleep", &Args{Num1: 10, Num2: 1}, &reply)
+	_assert(err == nil && reply == 11, "failed to call Foo.Sleep: %v", err)
+	err = cli.Call(context.Background(), "Foo.Sleep", &Args{Num1: 1000}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect a handle timeout, got %v", err)
+}
+
+func TestCancel(t *testing.T) {
+	addr := startServer(t)
+	cli, err := Dial("tcp", addr)
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = cli.Close() }()
+	var reply int
+
+	// 客户端的超时时间会带给服务端
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = cli.Call(ctx, "Foo.Sleep", &Args{Num1: 5000, Num2: -1}, &reply)
+	_assert(err != nil, "expect a timeout error")
+	select {
+	case err = <-canceled:
+		_assert(err == context.DeadlineExceeded, "expect deadline exceeded on server, got %v", err)
+	case <-time.After(time.Second):
+		_assert(false, "server handler was not canceled by deadline")
+	}
+
+	// 主动取消会通知服务端
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = cli.Call(ctx, "Foo.Sleep", &Args{Num1: 5000, Num2: -1}, &reply)
+	_assert(err != nil, "expect a canceled error")
+	select {
+	case err = <-canceled:
+		_assert(err == context.Canceled, "expect canceled on server, got %v", err)
+	case <-time.After(time.Second):
+		_assert(false, "server handler was not canceled")
+	}
+	cli.mu.Lock()
+	_assert(len(cli.Pending) == 0, "canceled call should be removed from pending")
+	cli.mu.Unlock()
+}
+
+func TestInterceptor(t *testing.T) {
+	addr := startServer(t)
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+			trace = append(trace, name)
+			return invoker(ctx, serviceMethod, args, reply)
+		}
+	}
+	// 把错误的方法名改成正确的方法名
+	rewrite := func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		if serviceMethod == "Foo.Add" {
+			serviceMethod = "Foo.Sum"
+		}
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+	cli, err := Dial("tcp", addr, &option.Option{Interceptors: []Interceptor{record("first"), record("second"), rewrite}})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = cli.Close() }()
+	var reply int
+	err = cli.Call(context.Background(), "Foo.Add", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "interceptor should rewrite the method: %v", err)
+	_assert(strings.Join(trace, ",") == "first,second", "wrong interceptor order %v", trace)
+}
+
+func TestServerStream(t *testing.T) {
+	addr := startServer(t)
+	cli, err := Dial("tcp", addr)
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = cli.Close() }()
+
+	var n int
+	st, err := cli.NewStream(context.Background(), "Foo.Count", &Args{Num1: 5}, &n)
+	_assert(err == nil, "failed to open stream: %v", err)
+	var got []int
+	for {
+		if err = st.Recv(&n); err != nil {
+			break
+		}
+		got = append(got, n)
+	}
+	_assert(err == io.EOF && fmt.Sprint(got) == "[0 1 2 3 4]", "wrong stream result %v %v", got, err)
+
+	st, err = cli.NewStream(context.Background(), "Foo.Count", &Args{Num1: 2, Num2: -1}, &n)
+	_assert(err == nil, "failed to open stream: %v", err)
+	for err == nil {
+		err = st.Recv(&n)
+	}
+	_assert(err.Error() == "count failed", "expect error frame, got %v", err)
+
+	// 普通方法不能用流式调用 流式方法也不能用普通调用
+	st, err = cli.NewStream(context.Background(), "Foo.Sum", &Args{Num1: 2}, &n)
+	if err == nil {
+		err = st.Recv(&n)
+	}
+	_assert(err != nil && err != io.EOF, "expect streaming mismatch, got %v", err)
+	err = cli.Call(context.Background(), "Foo.Count", &Args{Num1: 2}, &n)
+	_assert(err != nil, "expect streaming mismatch for Call")
+}
+
+func TestBidiStream(t *testing.T) {
+	addr := startServer(t)
+	cli, err := Dial("tcp", addr)
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = cli.Close() }()
+
+	// 消息数超过窗口 两个方向都需要窗口更新才能完成
+	const total = 3 * flow.Window
+	var n int
+	st, err := cli.NewStream(context.Background(), "Foo.Echo", &Args{Num1: 0, Num2: 0}, &n)
+	_assert(err == nil, "failed to open stream: %v", err)
+	sendErr := make(chan error, 1)
+	go func() {
+		for i := 1; i < total; i++ {
+			if err := st.Send(&Args{Num1: i, Num2: i}); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- st.CloseSend()
+	}()
+	for i := 0; ; i++ {
+		if err = st.Recv(&n); err != nil {
+			_assert(err == io.EOF && i == total, "stream ended early at %d: %v", i, err)
+			break
+		}
+		_assert(n == 2*i, "expect %d, got %d", 2*i, n)
+	}
+	_assert(<-sendErr == nil, "send failed")
+
+	// 服务端结束之后不能再发送
+	st, err = cli.NewStream(context.Background(), "Foo.Count", &Args{Num1: 1}, &n)
+	_assert(err == nil, "failed to open stream: %v", err)
+	for err == nil {
+		err = st.Recv(&n)
+	}
+	_assert(st.Send(&Args{}) != nil, "expect send on finished stream to fail")
+}
+
+func TestReconnect(t *testing.T) {
+	var foo Foo
+	serve := func(addr string) *server.Server {
+		l, err := net.Listen("tcp", addr)
+		_assert(err == nil, "failed to listen tcp: %v", err)
+		s := server.NewServer()
+		s.RegisterService(&foo)
+		go s.Accept(l)
+		return s
 	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp: %v", err)
+	addr := l.Addr().String()
+	_ = l.Close()
+	s := serve(addr)
+
+	rc := NewReconnectClient("tcp@"+addr, nil)
+	rc.SetBackoff(Backoff{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 2})
+	_assert(rc.State() == Idle, "expect idle before the first call")
+	var reply int
+	err = rc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3 && rc.State() == Ready, "first call failed: %v", err)
+
+	// 服务端关闭后进入失败状态 FailFast的调用立即失败
+	_ = s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for rc.State() != TransientFailure && rc.WaitForStateChange(ctx, rc.State()) {
+	}
+	rc.SetFailFast(true)
+	start := time.Now()
+	err = rc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	var st *status.Status
+	_assert(errors.As(err, &st) && st == ErrNotReady, "expect fail fast, got %v", err)
+	_assert(status.CodeOf(err) == status.Unavailable && time.Since(start) < 100*time.Millisecond, "fail fast should not wait for reconnect")
+
+	// 等待连接时ctx超时 错误码是DeadlineExceeded 不是可以重试的Unavailable
+	rc.SetFailFast(false)
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	err = rc.Call(short, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(status.CodeOf(err) == status.DeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+
+	// 服务端恢复后自动重连 等待中的调用会成功
+	s = serve(addr)
+	defer func() { _ = s.Close() }()
+	err = rc.Call(ctx, "Foo.Sum", &Args{Num1: 2, Num2: 3}, &reply)
+	_assert(err == nil && reply == 5, "call after reconnect failed: %v", err)
+	_assert(rc.Close() == nil && rc.Close() == ErrShutdown, "first close should succeed")
+
+	// 握手之后马上断开的服务端 重连也要按照退避策略等待
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp: %v", err)
+	defer func() { _ = l.Close() }()
+	var accepted int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			var opt option.Option
+			if json.NewDecoder(conn).Decode(&opt) == nil {
+				_ = json.NewEncoder(conn).Encode(&option.Handshake{Version: option.ProtocolVersion, CodecType: codec.GobType})
+			}
+			_ = conn.Close()
+		}
+	}()
+	rc = NewReconnectClient("tcp@"+l.Addr().String(), nil)
+	rc.SetBackoff(Backoff{BaseDelay: 20 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2})
+	rc.Connect()
+	time.Sleep(200 * time.Millisecond)
+	_ = rc.Close()
+	_assert(atomic.LoadInt32(&accepted) < 10, "flapping server should be retried with backoff, got %d connections", atomic.LoadInt32(&accepted))
 }
+
+// newCertificate 生成测试用的证书 parent为nil时生成自签名的CA
+func newCertificate(cn string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_assert(err == nil, "failed to generate key: %v", err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	_assert(err == nil, "failed to create certificate: %v", err)
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newCertificate("test ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{newCertificate("server", &ca)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{newCertificate("alice", &ca)},
+		RootCAs:      pool,
+	}
+
+	var foo Foo
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp: %v", err)
+	s := server.NewServer()
+	s.RegisterService(&foo)
+	s.HandshakeTimeout = 200 * time.Millisecond
+	identity := make(chan string, 1)
+	s.Use(func(ctx context.Context, info *server.RequestInfo, next server.Handler) error {
+		if p, ok := server.PeerFromContext(ctx); ok && p.Certificate() != nil {
+			identity <- p.Certificate().Subject.CommonName
+		}
+		return next(ctx, info)
+	})
+	go s.AcceptTLS(l, serverConfig)
+	defer func() { _ = s.Close() }()
+
+	cli, err := XDial("tls@"+l.Addr().String(), &option.Option{TLSConfig: clientConfig})
+	_assert(err == nil, "failed to dial tls: %v", err)
+	defer func() { _ = cli.Close() }()
+	var reply int
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "tls call failed: %v", err)
+	_assert(<-identity == "alice", "handler should see the client certificate")
+
+	// 没有配置TLS时不能使用tls地址 没有客户端证书时服务端拒绝
+	_, err = XDial("tls@" + l.Addr().String())
+	_assert(err == option.ErrTLSConfigRequired, "expect tls config error, got %v", err)
+	noCert, err := XDial("tls@"+l.Addr().String(), &option.Option{TLSConfig: &tls.Config{RootCAs: pool}})
+	if err == nil {
+		err = noCert.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	}
+	_assert(err != nil, "expect handshake failure without client certificate")
+
+	// 连接后不发送任何数据的客户端 服务端在握手超时后关闭连接
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "failed to dial tcp: %v", err)
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	var ne net.Error
+	_assert(err != nil && !(errors.As(err, &ne) && ne.Timeout()), "server should close a silent conn, got %v", err)
+}
+
 func _assert(condition bool, msg string, v ...interface{}) {
 	if !condition {
 		panic(fmt.Sprintf("assertion failed: "+msg, v...))
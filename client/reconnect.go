@@ -0,0 +1,305 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 22:50
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"rpc/option"
+	"rpc/status"
+	"sync"
+	"time"
+)
+
+// ConnState 可以重连的客户端的连接状态
+type ConnState int
+
+const (
+	Idle             ConnState = iota // 还没有发起连接
+	Connecting                        // 正在连接
+	Ready                             // 连接可用
+	TransientFailure                  // 连接失败 等待退避之后重连
+	Shutdown                          // 用户主动关闭
+)
+
+var connStateNames = []string{"IDLE", "CONNECTING", "READY", "TRANSIENT_FAILURE", "SHUTDOWN"}
+
+func (s ConnState) String() string {
+	if s >= 0 && int(s) < len(connStateNames) {
+		return connStateNames[s]
+	}
+	return "INVALID_STATE"
+}
+
+// Backoff 重连的指数退避策略 每次失败后等待时间乘以Multiplier 再加上随机抖动
+type Backoff struct {
+	BaseDelay  time.Duration // 第一次失败后的等待时间
+	MaxDelay   time.Duration // 等待时间的上限
+	Multiplier float64       // 每次失败后的增长倍数
+	Jitter     float64       // 随机抖动的比例 避免大量客户端同时重连
+	// StableTime 连接保持可用超过这个时间后退避才重新计数 为0时使用MaxDelay
+	// 连上之后马上被断开的连接算作一次失败 不会不停地重连
+	StableTime time.Duration
+}
+
+var DefaultBackoff = Backoff{
+	BaseDelay:  100 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	StableTime: 10 * time.Second,
+}
+
+func (b Backoff) stableTime() time.Duration {
+	if b.StableTime <= 0 {
+		return b.MaxDelay
+	}
+	return b.StableTime
+}
+
+// Delay 第retries次重试前的等待时间 retries从0开始
+func (b Backoff) Delay(retries int) time.Duration {
+	delay := float64(b.BaseDelay)
+	for i := 0; i < retries && delay < float64(b.MaxDelay); i++ {
+		delay *= b.Multiplier
+	}
+	if delay > float64(b.MaxDelay) {
+		delay = float64(b.MaxDelay)
+	}
+	delay *= 1 + b.Jitter*(rand.Float64()*2-1)
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+// ErrNotReady FailFast时连接不可用的错误 可以换一个服务端重试
+var ErrNotReady error = status.New(status.Unavailable, "rpc client: connection is not ready")
+
+// ReconnectClient 连接断开后自动重连的客户端 每次重连都会用同一个option重新握手
+// 连接断开时正在进行的调用会失败 不会自动重发 因为无法确定服务端是否已经处理
+type ReconnectClient struct {
+	rpcAddr  string
+	opt      *option.Option
+	mu       sync.Mutex
+	backoff  Backoff // 重连的退避策略
+	failFast bool    // 为true时连接不可用的调用立即失败 否则等待连接恢复或者ctx结束
+	state    ConnState
+	lastErr  error         // 最近一次连接失败的原因
+	cli      *Client       // 当前的连接
+	changed  chan struct{} // 状态变化时关闭并替换
+	done     chan struct{} // Close时关闭
+}
+
+// NewReconnectClient 创建可以重连的客户端 rpcAddr的格式和XDial相同 第一次调用时才发起连接
+func NewReconnectClient(rpcAddr string, opt *option.Option) *ReconnectClient {
+	return &ReconnectClient{
+		backoff: DefaultBackoff,
+		rpcAddr: rpcAddr,
+		opt:     opt,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// SetBackoff 设置重连的退避策略 从下一次等待开始生效
+func (rc *ReconnectClient) SetBackoff(b Backoff) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.backoff = b
+}
+
+// SetFailFast 为true时连接不可用的调用立即失败 否则等待连接恢复或者ctx结束
+func (rc *ReconnectClient) SetFailFast(failFast bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.failFast = failFast
+}
+
+// State 当前的连接状态
+func (rc *ReconnectClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// WaitForStateChange 等待状态离开source 状态改变时返回true ctx结束时返回false
+func (rc *ReconnectClient) WaitForStateChange(ctx context.Context, source ConnState) bool {
+	rc.mu.Lock()
+	for rc.state == source {
+		changed := rc.changed
+		rc.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+		rc.mu.Lock()
+	}
+	rc.mu.Unlock()
+	return true
+}
+
+// Connect 从Idle状态开始连接 不等待连接完成
+func (rc *ReconnectClient) Connect() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.connectLocked()
+}
+
+func (rc *ReconnectClient) connectLocked() {
+	if rc.state == Idle {
+		rc.setStateLocked(Connecting, nil)
+		go rc.run()
+	}
+}
+
+func (rc *ReconnectClient) setStateLocked(state ConnState, err error) {
+	rc.state = state
+	if err != nil {
+		rc.lastErr = err
+	}
+	close(rc.changed)
+	rc.changed = make(chan struct{})
+}
+
+func (rc *ReconnectClient) setState(state ConnState, err error) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.state == Shutdown {
+		return false
+	}
+	rc.setStateLocked(state, err)
+	return true
+}
+
+// wait 按照退避策略等待 客户端关闭时返回false
+func (rc *ReconnectClient) wait(retries int) bool {
+	rc.mu.Lock()
+	delay := rc.backoff.Delay(retries)
+	rc.mu.Unlock()
+	select {
+	case <-time.After(delay):
+		return true
+	case <-rc.done:
+		return false
+	}
+}
+
+// run 维护连接 连接稳定一段时间后断开时立即重连 否则按照退避策略等待
+func (rc *ReconnectClient) run() {
+	for retries := 0; ; {
+		if !rc.setState(Connecting, nil) {
+			return
+		}
+		cli, err := XDial(rc.rpcAddr, rc.opt)
+		if err != nil {
+			if !rc.setState(TransientFailure, err) || !rc.wait(retries) {
+				return
+			}
+			retries++
+			continue
+		}
+		rc.mu.Lock()
+		if rc.state == Shutdown {
+			rc.mu.Unlock()
+			_ = cli.Close()
+			return
+		}
+		rc.cli = cli
+		rc.setStateLocked(Ready, nil)
+		stable := rc.backoff.stableTime()
+		rc.mu.Unlock()
+		connected := time.Now()
+		select {
+		case <-cli.Done():
+			if !rc.setState(TransientFailure, status.New(status.Unavailable, "rpc client: connection lost")) {
+				return
+			}
+		case <-rc.done:
+			return
+		}
+		if time.Since(connected) >= stable {
+			// 连接稳定了一段时间 退避重新计数
+			retries = 0
+			continue
+		}
+		if !rc.wait(retries) {
+			return
+		}
+		retries++
+	}
+}
+
+// client 取出可用的连接 FailFast时连接失败立即返回错误
+func (rc *ReconnectClient) client(ctx context.Context) (*Client, error) {
+	rc.mu.Lock()
+	for {
+		switch rc.state {
+		case Shutdown:
+			rc.mu.Unlock()
+			return nil, ErrShutdown
+		case Ready:
+			cli := rc.cli
+			rc.mu.Unlock()
+			return cli, nil
+		case Idle:
+			rc.connectLocked()
+		case TransientFailure:
+			if rc.failFast {
+				err := rc.lastErr
+				rc.mu.Unlock()
+				return nil, fmt.Errorf("%w: %v", ErrNotReady, err)
+			}
+		}
+		changed := rc.changed
+		rc.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			// 保留ctx的错误 超时是DeadlineExceeded 不能当作可以重试的Unavailable
+			return nil, fmt.Errorf("rpc client: connection is not ready: %w", ctx.Err())
+		}
+		rc.mu.Lock()
+	}
+}
+
+// Call 在当前连接上调用 连接不可用时按照FailFast决定等待还是失败
+func (rc *ReconnectClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	cli, err := rc.client(ctx)
+	if err != nil {
+		return err
+	}
+	return cli.Call(ctx, serviceMethod, args, reply)
+}
+
+// NewStream 在当前连接上发起流式调用
+func (rc *ReconnectClient) NewStream(ctx context.Context, serviceMethod string, args, reply interface{}) (*Stream, error) {
+	cli, err := rc.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cli.NewStream(ctx, serviceMethod, args, reply)
+}
+
+// Close 关闭客户端 之后不会再重连 重复关闭时返回ErrShutdown
+func (rc *ReconnectClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.state == Shutdown {
+		return ErrShutdown
+	}
+	rc.setStateLocked(Shutdown, nil)
+	close(rc.done)
+	if rc.cli != nil {
+		// 断开的连接已经关闭过 它的错误对调用方没有意义
+		_ = rc.cli.Close()
+	}
+	return nil
+}
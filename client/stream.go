@@ -0,0 +1,199 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 18:50
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"rpc/codec"
+	"rpc/flow"
+	"rpc/logger"
+	"rpc/metadata"
+	"rpc/option"
+	"sync"
+)
+
+var (
+	ErrStreamingUnsupported = errors.New("rpc client: server does not support streaming")
+	ErrStreamClosed         = errors.New("rpc client: stream is closed")
+)
+
+// Stream 客户端的流式调用 服务端的每条回复先放入队列 再由Recv依次取出
+// 打开流时的args是发给服务端的第一条消息 之后可以通过Send继续发送
+type Stream struct {
+	client *Client
+	call   *Call
+	ctx    context.Context
+	typ    reflect.Type // 回复的类型
+	queue  *flow.Queue  // 收到的回复
+	credit *flow.Credit // 发送额度
+	mu     sync.Mutex   // 保护closeSend
+	// closeSend 已经关闭发送
+	closeSend bool
+}
+
+// NewStream 发起一个流式调用 reply只用来确定回复的类型 必须是指针
+func (c *Client) NewStream(ctx context.Context, serviceMethod string, args, reply interface{}) (*Stream, error) {
+	if !option.HasFeature(c.Opt.Features, option.FeatureStreaming) {
+		return nil, ErrStreamingUnsupported
+	}
+	typ := reflect.TypeOf(reply)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		return nil, errors.New("rpc client: stream reply must be a pointer")
+	}
+	st := &Stream{
+		client: c,
+		ctx:    ctx,
+		typ:    typ.Elem(),
+		queue:  flow.NewQueue(),
+		credit: flow.NewCredit(),
+	}
+	st.call = &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		done:          make(chan *Call, 1),
+		ctx:           ctx,
+		stream:        st,
+	}
+	c.send(st.call)
+	// 发送失败的话send已经把错误写入了call
+	select {
+	case call := <-st.call.done:
+		if call.Err != nil {
+			return nil, call.Err
+		}
+	default:
+	}
+	return st, nil
+}
+
+// Send 向服务端发送一条消息 服务端处理不过来时会等待窗口
+func (st *Stream) Send(args interface{}) error {
+	st.mu.Lock()
+	closed := st.closeSend
+	st.mu.Unlock()
+	if closed {
+		return ErrStreamClosed
+	}
+	if err := st.credit.Acquire(st.ctx); err != nil {
+		return err
+	}
+	return st.write(codec.FlagStreamData, args)
+}
+
+// CloseSend 关闭发送方向 服务端的Recv会返回io.EOF 之后仍然可以继续Recv
+func (st *Stream) CloseSend() error {
+	st.mu.Lock()
+	if st.closeSend {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closeSend = true
+	st.mu.Unlock()
+	return st.write(codec.FlagHalfClose, invalidRequest)
+}
+
+// write 发送流中的后续消息 每条消息使用新的Seq 通过StreamID找到对应的流
+func (st *Stream) write(flags uint16, body interface{}) error {
+	c := st.client
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	seq, err := c.nextSeq()
+	if err != nil {
+		return err
+	}
+	header := codec.Header{ServiceMethod: st.call.ServiceMethod, Seq: seq, StreamID: st.call.Seq, Flags: flags}
+	return c.Codec.Write(&header, body)
+}
+
+// Recv 接收下一条回复 流正常结束时返回io.EOF
+func (st *Stream) Recv(reply interface{}) error {
+	v, update, err := st.queue.Pop(st.ctx)
+	if err != nil {
+		if st.ctx.Err() != nil && err == st.ctx.Err() {
+			st.client.cancel(st.call)
+			err = fmt.Errorf("rpc client: stream failed: %w", err)
+			st.finish(err)
+		}
+		return err
+	}
+	reflect.ValueOf(reply).Elem().Set(v.Elem())
+	if update > 0 {
+		// 归还窗口 服务端才能继续发送
+		c := st.client
+		c.sending.Lock()
+		defer c.sending.Unlock()
+		header := codec.Header{Seq: st.call.Seq, StreamID: st.call.Seq, Flags: codec.FlagWindowUpdate, Window: uint32(update)}
+		if err = c.Codec.Write(&header, invalidRequest); err != nil {
+			logger.Logger.Println("rpc client: send window update fail,err:", err)
+		}
+	}
+	return nil
+}
+
+// Trailer 服务端返回的trailer Recv返回错误之后才有
+func (st *Stream) Trailer() metadata.MD {
+	return st.call.Trailer
+}
+
+// Close 提前结束流 服务端的处理会被取消
+func (st *Stream) Close() error {
+	st.client.cancel(st.call)
+	st.finish(ErrStreamClosed)
+	return nil
+}
+
+// push 放入一条回复 服务端没有遵守流控时结束整个流
+func (st *Stream) push(v reflect.Value) {
+	if err := st.queue.Push(v); err != nil {
+		st.finish(err)
+		st.client.cancel(st.call)
+	}
+}
+
+// finish 结束流 只记录第一次的原因 等待发送额度的Send也会返回
+func (st *Stream) finish(err error) {
+	st.queue.Finish(err)
+	st.credit.Close(err)
+}
+
+// receiveStream 读取流中的一条回复 放入对应流的队列
+func (c *Client) receiveStream(header *codec.Header) error {
+	c.mu.Lock()
+	call := c.Pending[header.Seq]
+	c.mu.Unlock()
+	if call == nil || call.stream == nil {
+		logger.Logger.Println("stream is empty")
+		return c.Codec.ReadBody(nil)
+	}
+	reply := reflect.New(call.stream.typ)
+	if err := c.Codec.ReadBody(reply.Interface()); err != nil {
+		if !codec.IsBodyError(err) {
+			return err
+		}
+		// 帧模式下body解析失败只结束当前的流
+		call.stream.finish(err)
+		c.cancel(call)
+		return nil
+	}
+	call.stream.push(reply)
+	return nil
+}
+
+// receiveWindow 服务端归还了窗口
+func (c *Client) receiveWindow(header *codec.Header) error {
+	c.mu.Lock()
+	call := c.Pending[header.StreamID]
+	c.mu.Unlock()
+	if call != nil && call.stream != nil {
+		call.stream.credit.Add(int(header.Window))
+	}
+	return c.Codec.ReadBody(nil)
+}
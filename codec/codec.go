@@ -13,14 +13,34 @@ import (
 	"io"
 	"net"
 	"rpc/logger"
+	"time"
 )
 
 type Header struct {
-	ServiceMethod string // 需要获取的服务模块名+函数名
-	Seq           uint64 // 请求的序列号
-	Err           string //请求过程中的错误信息
+	ServiceMethod string            // 需要获取的服务模块名+函数名
+	Seq           uint64            // 请求的序列号
+	Err           string            //请求过程中的错误信息
+	Flags         uint16            // 消息标记 帧模式下同时写在帧头中
+	Timeout       time.Duration     // 客户端剩余的超时时间 0表示没有 用相对时间避免两边时钟不一致
+	StreamID      uint64            // 流的编号 等于打开流的请求的Seq
+	Window        uint32            // 窗口更新消息中归还的窗口大小
+	Auth          string            // 这次请求的凭证 为空时使用握手时认证的身份
+	Code          uint32            // 错误码 见status包 旧版本的对端只会设置Err
+	Details       []byte            // 错误的附加信息 json编码
+	Metadata      map[string]string // 请求中是客户端的metadata 回复中是服务端的trailer
 }
 
+// header中的标记位
+const (
+	FlagCompressed   uint16 = 1 << iota // body经过了压缩
+	FlagCancel                          // 客户端取消Seq对应的请求
+	FlagDrain                           // 服务端正在关闭 不要再发送新的请求
+	FlagStreamData                      // 流式调用中的消息 打开流的请求也带有这个标记
+	FlagStreamClose                     // 流结束 Err不为空表示出错
+	FlagHalfClose                       // 客户端不再发送消息 服务端仍然可以继续回复
+	FlagWindowUpdate                    // 流控窗口更新 Window是归还的消息数
+)
+
 type NewCodecFunc func(conn net.Conn) Codec
 
 // Codec 定义编码器接口
@@ -41,6 +61,7 @@ const (
 
 func init() {
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
 
 type GobCodec struct {
@@ -73,6 +94,14 @@ func (g *GobCodec) Close() error {
 }
 
 func (g *GobCodec) Write(header *Header, body interface{}) (err error) {
+	// 先注册defer 保证即使编码失败也会把缓存刷出去并关闭连接
+	defer func() {
+		_ = g.buf.Flush()
+		if err != nil {
+			logger.Logger.Println("write data fail!")
+			_ = g.conn.Close()
+		}
+	}()
 	if err = g.enc.Encode(header); err != nil {
 		logger.Logger.Println("encode header fail!")
 		return
@@ -81,13 +110,5 @@ func (g *GobCodec) Write(header *Header, body interface{}) (err error) {
 		logger.Logger.Println("encode body fail!")
 		return
 	}
-	defer func() {
-		_ = g.buf.Flush()
-		if err != nil {
-			logger.Logger.Println("write data fail!")
-			_ = g.conn.Close()
-			return
-		}
-	}()
 	return nil
 }
@@ -0,0 +1,111 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 11:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+type Args struct{ Num1, Num2 int }
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func TestFrameCodec(t *testing.T) {
+	for _, typ := range []string{GobType, JsonType} {
+		c1, c2 := net.Pipe()
+		w, r := NewFrameCodec(c1, typ), NewFrameCodec(c2, typ)
+		go func() {
+			_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, &Args{Num1: 1, Num2: 2})
+			_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, "not args")
+			_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 3}, &Args{Num1: 3, Num2: 4})
+		}()
+		var h Header
+		var args Args
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 1, "%s: failed to read first header", typ)
+		_assert(r.ReadBody(&args) == nil && args.Num2 == 2, "%s: failed to read first body", typ)
+		// body类型不对只影响当前帧
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 2, "%s: failed to read second header", typ)
+		err := r.ReadBody(&args)
+		_assert(IsBodyError(err), "%s: expect body error, got %v", typ, err)
+		_assert(r.ReadHeader(&h) == nil && h.Seq == 3, "%s: frame after bad body should be readable", typ)
+		_assert(r.ReadBody(&args) == nil && args.Num1 == 3, "%s: failed to read third body", typ)
+		_ = w.Close()
+		_ = r.Close()
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	old := MaxFrameSize
+	MaxFrameSize = 512
+	defer func() { MaxFrameSize = old }()
+	c1, c2 := net.Pipe()
+	w, r := NewFrameCodec(c1, GobType), NewFrameCodec(c2, GobType)
+	go func() {
+		_ = w.Write(&Header{ServiceMethod: "Foo.Big", Seq: 1}, make([]byte, 4096))
+		_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, 1)
+	}()
+	var h Header
+	_assert(r.ReadHeader(&h) == nil && h.ServiceMethod == "Foo.Big", "header of large frame should be readable")
+	_assert(IsBodyError(r.ReadBody(nil)), "large body should be skipped")
+	var n int
+	_assert(r.ReadHeader(&h) == nil && h.Seq == 2 && r.ReadBody(&n) == nil && n == 1, "failed to read frame after large one")
+}
+
+func TestDecompressLimit(t *testing.T) {
+	old := MaxFrameSize
+	MaxFrameSize = 4096
+	defer func() { MaxFrameSize = old }()
+	c1, c2 := net.Pipe()
+	w := NewCompressCodec(NewFrameCodec(c1, GobType), GobType, Gzip, 0)
+	r := NewCompressCodec(NewFrameCodec(c2, GobType), GobType, Gzip, 0)
+	go func() {
+		// 压缩后很小 解压后超过MaxFrameSize
+		_ = w.Write(&Header{ServiceMethod: "Foo.Bomb", Seq: 1}, make([]byte, 64<<10))
+		_ = w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, 1)
+	}()
+	var h Header
+	var got []byte
+	_assert(r.ReadHeader(&h) == nil && h.Flags&FlagCompressed != 0, "bomb should be compressed")
+	err := r.ReadBody(&got)
+	_assert(IsBodyError(err) && errors.Is(err, ErrFrameTooLarge), "expect frame too large, got %v", err)
+	var n int
+	_assert(r.ReadHeader(&h) == nil && h.Seq == 2 && r.ReadBody(&n) == nil && n == 1, "failed to read frame after bomb")
+}
+
+func TestCompressCodec(t *testing.T) {
+	for _, typ := range []string{GobType, JsonType} {
+		c1, c2 := net.Pipe()
+		w := NewCompressCodec(NewCodecFuncMap[typ](c1), typ, Gzip, 0)
+		r := NewCompressCodec(NewCodecFuncMap[typ](c2), typ, Gzip, 0)
+		big := make([]int, 4096)
+		for i := range big {
+			big[i] = i % 7
+		}
+		go func() {
+			_ = w.Write(&Header{ServiceMethod: "Foo.Big", Seq: 1}, big)
+			_ = w.Write(&Header{ServiceMethod: "Foo.Small", Seq: 2}, 42)
+		}()
+		var h Header
+		var got []int
+		_assert(r.ReadHeader(&h) == nil && h.Flags&FlagCompressed != 0, "%s: large body should be compressed", typ)
+		_assert(r.ReadBody(&got) == nil && len(got) == len(big) && got[13] == 6, "%s: failed to read compressed body", typ)
+		var n int
+		h = Header{}
+		_assert(r.ReadHeader(&h) == nil && h.Flags&FlagCompressed == 0, "%s: small body should not be compressed", typ)
+		_assert(r.ReadBody(&n) == nil && n == 42, "%s: failed to read small body", typ)
+		_ = w.Close()
+		_ = r.Close()
+	}
+}
@@ -0,0 +1,153 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 14:10
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	Gzip  = "gzip"
+	Zlib  = "zlib"
+	Flate = "flate"
+)
+
+// DefaultCompressThreshold body编码后小于这个长度时不压缩
+const DefaultCompressThreshold = 1024
+
+// Compressor 压缩算法接口
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// CompressorMap 全局压缩算法MAP
+var CompressorMap = map[string]Compressor{
+	Gzip: &streamCompressor{
+		newWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+	Zlib: &streamCompressor{
+		newWriter: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) },
+	},
+	Flate: &streamCompressor{
+		newWriter: func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+	},
+}
+
+// streamCompressor 包装标准库中基于流的压缩算法
+type streamCompressor struct {
+	newWriter func(w io.Writer) io.WriteCloser
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+func (s *streamCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := s.newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress 解压后的长度同样受MaxFrameSize限制 避免很小的帧解压出巨大的数据
+func (s *streamCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := s.newReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	limit := int64(MaxFrameSize)
+	out, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, ErrFrameTooLarge
+	}
+	return out, nil
+}
+
+// CompressCodec 压缩包装器 可以包装任意的编码器
+// body先序列化成字节 超过阈值时压缩 并在header中打上压缩标记
+type CompressCodec struct {
+	Codec
+	serializer Serializer
+	compressor Compressor
+	threshold  int
+	flags      uint16 // 最近一次读取的header标记
+}
+
+// NewCompressCodec 创建压缩包装器 codecType决定body的序列化方式
+func NewCompressCodec(c Codec, codecType, compress string, threshold int) Codec {
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	return &CompressCodec{
+		Codec:      c,
+		serializer: SerializerMap[codecType],
+		compressor: CompressorMap[compress],
+		threshold:  threshold,
+	}
+}
+
+func (c *CompressCodec) ReadHeader(header *Header) error {
+	err := c.Codec.ReadHeader(header)
+	c.flags = header.Flags
+	return err
+}
+
+func (c *CompressCodec) ReadBody(body interface{}) error {
+	var data []byte
+	if err := c.Codec.ReadBody(&data); err != nil {
+		return err
+	}
+	if body == nil {
+		return nil
+	}
+	if c.flags&FlagCompressed != 0 {
+		var err error
+		if data, err = c.compressor.Decompress(data); err != nil {
+			return &BodyError{Err: err}
+		}
+	}
+	if err := c.serializer.Unmarshal(data, body); err != nil {
+		return &BodyError{Err: err}
+	}
+	return nil
+}
+
+func (c *CompressCodec) Write(header *Header, body interface{}) error {
+	data, err := c.serializer.Marshal(body)
+	if err != nil {
+		return err
+	}
+	// 复制一份header 不修改调用方的header
+	h := *header
+	h.Flags &^= FlagCompressed
+	if len(data) >= c.threshold {
+		if data, err = c.compressor.Compress(data); err != nil {
+			return err
+		}
+		h.Flags |= FlagCompressed
+	}
+	return c.Codec.Write(&h, data)
+}
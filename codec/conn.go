@@ -0,0 +1,36 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 13:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package codec
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+)
+
+// bufferedConn 读取时先读出握手时缓存的数据 再读连接中的数据
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// NewBufferedConn json解码器可能多读了握手消息后面的数据 需要先把缓存的数据交给编码器
+func NewBufferedConn(conn net.Conn, buffered io.Reader) net.Conn {
+	data, _ := ioutil.ReadAll(buffered)
+	// 去掉json编码器在消息后面追加的换行符
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 {
+		return conn
+	}
+	return &bufferedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(data), conn)}
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
@@ -0,0 +1,251 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 10:40
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"rpc/logger"
+)
+
+// 帧格式:
+// | magic(2) | version(1) | codec id(1) | flags(2) | seq(8) | body length(4) | payload |
+// payload = uvarint(header长度) + header编码 + body编码
+// 版本1的flags只有1个字节 不能和版本2互通
+const (
+	FrameMagic     uint16 = 0x5250
+	FrameVersion   uint8  = 2
+	frameHeaderLen        = 18
+)
+
+// MaxFrameSize 单个帧payload的最大长度 超过的帧会被跳过
+var MaxFrameSize uint32 = 16 << 20
+
+var (
+	ErrBadMagic      = errors.New("rpc codec: invalid frame magic")
+	ErrBadVersion    = errors.New("rpc codec: unsupported frame version")
+	ErrFrameTooLarge = errors.New("rpc codec: frame too large")
+)
+
+// BodyError body解析失败 但整个帧已经读完 连接上后续的消息不受影响
+type BodyError struct {
+	Err error
+}
+
+func (e *BodyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// IsBodyError 判断错误是否只影响当前这条消息
+func IsBodyError(err error) bool {
+	var e *BodyError
+	return errors.As(err, &e)
+}
+
+// Serializer 把单个值编码成字节 帧模式下每个帧独立编码
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// SerializerMap 编码类型对应的序列化器
+var SerializerMap = map[string]Serializer{
+	GobType:  gobSerializer{},
+	JsonType: jsonSerializer{},
+}
+
+// CodecIDMap 编码类型在帧头中的编号
+var CodecIDMap = map[string]uint8{
+	GobType:  1,
+	JsonType: 2,
+}
+
+type gobSerializer struct{}
+
+func (gobSerializer) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobSerializer) Unmarshal(data []byte, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// FrameCodec 带长度前缀的帧编码器 每个消息都是一个独立的帧
+type FrameCodec struct {
+	conn       io.ReadWriteCloser
+	r          *bufio.Reader
+	buf        *bufio.Writer
+	codecID    uint8
+	serializer Serializer
+	body       []byte // 当前帧中还没有读取的body
+	bodyErr    error  // 当前帧body不可用的原因
+}
+
+// NewFrameCodec 创建帧编码器 codecType决定帧内header和body的编码方式
+func NewFrameCodec(conn net.Conn, codecType string) Codec {
+	return &FrameCodec{
+		conn:       conn,
+		r:          bufio.NewReader(conn),
+		buf:        bufio.NewWriter(conn),
+		codecID:    CodecIDMap[codecType],
+		serializer: SerializerMap[codecType],
+	}
+}
+
+func (f *FrameCodec) ReadHeader(header *Header) error {
+	var fh [frameHeaderLen]byte
+	if _, err := io.ReadFull(f.r, fh[:]); err != nil {
+		return err
+	}
+	// 魔数和版本不对的话无法再找到下一个帧的位置 只能返回错误
+	if binary.BigEndian.Uint16(fh[0:2]) != FrameMagic {
+		return ErrBadMagic
+	}
+	if fh[2] != FrameVersion {
+		return ErrBadVersion
+	}
+	flags := binary.BigEndian.Uint16(fh[4:6])
+	seq := binary.BigEndian.Uint64(fh[6:14])
+	length := binary.BigEndian.Uint32(fh[14:18])
+	if fh[3] != f.codecID {
+		// 编码方式不一致 跳过整个帧
+		if err := f.discard(int64(length)); err != nil {
+			return err
+		}
+		return fmt.Errorf("rpc codec: unexpected codec id %d", fh[3])
+	}
+	headerLen, err := binary.ReadUvarint(f.r)
+	if err != nil {
+		return err
+	}
+	used := uint32(uvarintLen(headerLen))
+	if used > length {
+		return ErrFrameTooLarge
+	}
+	if headerLen > uint64(length-used) || headerLen > uint64(MaxFrameSize) {
+		_ = f.discard(int64(length - used))
+		return ErrFrameTooLarge
+	}
+	data := make([]byte, headerLen)
+	if _, err = io.ReadFull(f.r, data); err != nil {
+		return err
+	}
+	bodyLen := length - used - uint32(headerLen)
+	f.body, f.bodyErr = nil, nil
+	if length > MaxFrameSize {
+		// body太大时只丢弃body 保留header 方便服务端给出错误回复
+		if err = f.discard(int64(bodyLen)); err != nil {
+			return err
+		}
+		f.bodyErr = &BodyError{Err: ErrFrameTooLarge}
+	} else {
+		f.body = make([]byte, bodyLen)
+		if _, err = io.ReadFull(f.r, f.body); err != nil {
+			return err
+		}
+	}
+	err = f.serializer.Unmarshal(data, header)
+	header.Seq, header.Flags = seq, flags
+	if err != nil {
+		return &BodyError{Err: err}
+	}
+	return nil
+}
+
+func (f *FrameCodec) ReadBody(body interface{}) error {
+	data, bodyErr := f.body, f.bodyErr
+	f.body, f.bodyErr = nil, nil
+	if bodyErr != nil {
+		return bodyErr
+	}
+	if err := f.serializer.Unmarshal(data, body); err != nil {
+		return &BodyError{Err: err}
+	}
+	return nil
+}
+
+func (f *FrameCodec) Close() error {
+	return f.conn.Close()
+}
+
+func (f *FrameCodec) Write(header *Header, body interface{}) (err error) {
+	defer func() {
+		if err != nil {
+			logger.Logger.Println("write frame fail!")
+		}
+	}()
+	h, err := f.serializer.Marshal(header)
+	if err != nil {
+		return
+	}
+	b, err := f.serializer.Marshal(body)
+	if err != nil {
+		return
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(h)))
+	var fh [frameHeaderLen]byte
+	binary.BigEndian.PutUint16(fh[0:2], FrameMagic)
+	fh[2] = FrameVersion
+	fh[3] = f.codecID
+	binary.BigEndian.PutUint16(fh[4:6], header.Flags)
+	binary.BigEndian.PutUint64(fh[6:14], header.Seq)
+	binary.BigEndian.PutUint32(fh[14:18], uint32(n+len(h)+len(b)))
+	for _, p := range [][]byte{fh[:], lenBuf[:n], h, b} {
+		if _, err = f.buf.Write(p); err != nil {
+			_ = f.conn.Close()
+			return
+		}
+	}
+	if err = f.buf.Flush(); err != nil {
+		_ = f.conn.Close()
+	}
+	return
+}
+
+func (f *FrameCodec) discard(n int64) error {
+	_, err := io.CopyN(ioutil.Discard, f.r, n)
+	return err
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
@@ -0,0 +1,70 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 10:02
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"rpc/logger"
+)
+
+// JsonCodec 使用json编码 方便其他语言的客户端接入
+type JsonCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+func NewJsonCodec(conn net.Conn) Codec {
+	buf := bufio.NewWriter(conn)
+	return &JsonCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(buf),
+	}
+}
+
+func (j *JsonCodec) ReadHeader(header *Header) error {
+	return j.dec.Decode(header)
+}
+
+func (j *JsonCodec) ReadBody(body interface{}) error {
+	// json不能直接解码到nil 先读成原始数据再丢弃 保证后面的消息不会错位
+	if body == nil {
+		var raw json.RawMessage
+		return j.dec.Decode(&raw)
+	}
+	return j.dec.Decode(body)
+}
+
+func (j *JsonCodec) Close() error {
+	return j.conn.Close()
+}
+
+func (j *JsonCodec) Write(header *Header, body interface{}) (err error) {
+	defer func() {
+		_ = j.buf.Flush()
+		if err != nil {
+			logger.Logger.Println("write data fail!")
+			_ = j.conn.Close()
+		}
+	}()
+	if err = j.enc.Encode(header); err != nil {
+		logger.Logger.Println("encode header fail!")
+		return
+	}
+	if err = j.enc.Encode(body); err != nil {
+		logger.Logger.Println("encode body fail!")
+		return
+	}
+	return nil
+}
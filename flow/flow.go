@@ -0,0 +1,163 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 19:30
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package flow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Window 流控窗口 每个流在每个方向上 收到窗口更新之前最多发送的消息数
+const Window = 64
+
+// ErrWindowExceeded 对端发送的消息超过了窗口
+var ErrWindowExceeded = errors.New("rpc flow: stream window exceeded")
+
+// Queue 一个流的接收队列 读取连接的协程只负责放入 不会因为某个流处理慢而阻塞
+type Queue struct {
+	mu       sync.Mutex
+	items    []reflect.Value // 还没有被取走的消息
+	err      error           // 队列结束的原因
+	consumed int             // 还没有归还给对端的窗口
+	notify   chan struct{}   // 有新的消息或者队列结束时通知
+}
+
+func NewQueue() *Queue {
+	return &Queue{notify: make(chan struct{}, 1)}
+}
+
+// Push 放入一条消息 超过窗口说明对端没有遵守流控
+func (q *Queue) Push(v reflect.Value) error {
+	q.mu.Lock()
+	if len(q.items) >= Window {
+		q.mu.Unlock()
+		return ErrWindowExceeded
+	}
+	q.items = append(q.items, v)
+	q.mu.Unlock()
+	q.signal()
+	return nil
+}
+
+// Finish 结束队列 已经放入的消息仍然可以取出 只记录第一次的原因
+func (q *Queue) Finish(err error) {
+	q.mu.Lock()
+	if q.err == nil {
+		q.err = err
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+// Pop 取出一条消息 update大于0时需要把这么多窗口归还给对端
+func (q *Queue) Pop(ctx context.Context) (v reflect.Value, update int, err error) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			v = q.items[0]
+			q.items = q.items[1:]
+			q.consumed++
+			// 消费了一半窗口之后再归还 减少窗口更新消息的数量
+			if q.consumed >= Window/2 {
+				update, q.consumed = q.consumed, 0
+			}
+			left := len(q.items) > 0
+			q.mu.Unlock()
+			if left {
+				q.signal()
+			}
+			return v, update, nil
+		}
+		err = q.err
+		q.mu.Unlock()
+		if err != nil {
+			q.signal()
+			return v, 0, err
+		}
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return v, 0, ctx.Err()
+		}
+	}
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Credit 一个流的发送额度 用完之后等待对端的窗口更新
+type Credit struct {
+	mu     sync.Mutex
+	n      int
+	err    error
+	notify chan struct{}
+}
+
+func NewCredit() *Credit {
+	return &Credit{n: Window, notify: make(chan struct{}, 1)}
+}
+
+// Acquire 获取一条消息的发送额度
+func (c *Credit) Acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if c.err != nil {
+			err := c.err
+			c.mu.Unlock()
+			// 继续唤醒其他等待的发送方
+			c.signal()
+			return err
+		}
+		if c.n > 0 {
+			c.n--
+			left := c.n
+			c.mu.Unlock()
+			if left > 0 {
+				c.signal()
+			}
+			return nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Add 收到窗口更新之后增加额度
+func (c *Credit) Add(n int) {
+	c.mu.Lock()
+	c.n += n
+	c.mu.Unlock()
+	c.signal()
+}
+
+// Close 流结束后唤醒所有等待额度的发送方
+func (c *Credit) Close(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *Credit) signal() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,106 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 17:40
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package health
+
+import (
+	"sync"
+)
+
+// 健康检查服务使用保留的名字 不会和用户注册的服务冲突
+const (
+	ServiceName = "rpc.Health"
+	CheckMethod = ServiceName + ".Check"
+)
+
+// ServingStatus 服务的健康状态
+type ServingStatus int
+
+const (
+	Unknown        ServingStatus = iota // 还没有设置状态
+	Serving                             // 可以正常处理请求
+	NotServing                          // 不能处理请求 例如正在关闭
+	ServiceUnknown                      // 服务端上没有这个服务
+)
+
+var servingStatusNames = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+func (s ServingStatus) String() string {
+	if s >= 0 && int(s) < len(servingStatusNames) {
+		return servingStatusNames[s]
+	}
+	return "INVALID_STATUS"
+}
+
+// CheckRequest Service为空时检查整个服务端 否则检查对应的服务
+type CheckRequest struct {
+	Service string
+}
+
+type CheckResponse struct {
+	Status ServingStatus
+}
+
+// Server 保存服务端和每个服务的健康状态 空字符串表示整个服务端
+type Server struct {
+	mu       sync.RWMutex
+	shutdown bool
+	statuses map[string]ServingStatus
+}
+
+// NewServer 创建健康状态 整个服务端默认是Serving
+func NewServer() *Server {
+	return &Server{statuses: map[string]ServingStatus{"": Serving}}
+}
+
+// SetServingStatus 设置服务的状态 Shutdown之后不再生效
+func (s *Server) SetServingStatus(service string, st ServingStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return
+	}
+	s.statuses[service] = st
+}
+
+// Shutdown 把所有服务设置为NotServing 服务端关闭时调用 让客户端尽快摘除这个地址
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = true
+	for service := range s.statuses {
+		s.statuses[service] = NotServing
+	}
+}
+
+// Check 服务的状态 没有设置过的服务返回false
+func (s *Server) Check(service string) (ServingStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.statuses[service]
+	return st, ok
+}
+
+// Health 注册到rpc服务端的健康检查服务 只暴露Check方法
+type Health struct {
+	srv *Server
+}
+
+func NewHealth(srv *Server) *Health {
+	return &Health{srv: srv}
+}
+
+// Check 没有这个服务时返回ServiceUnknown 而不是错误
+// 这样客户端收到NotFound时可以确定是服务端没有健康检查服务
+func (h *Health) Check(req CheckRequest, resp *CheckResponse) error {
+	st, ok := h.srv.Check(req.Service)
+	if !ok {
+		st = ServiceUnknown
+	}
+	resp.Status = st
+	return nil
+}
@@ -39,7 +39,8 @@ func startServer(registryAddr string, wg *sync.WaitGroup) {
 	l, _ := net.Listen("tcp", ":0")
 	server := server.NewServer()
 	server.RegisterService(&foo)
-	registry.HeartBeat(registryAddr, "tcp@"+l.Addr().String(), 0)
+	// 服务端关闭时会停止心跳并从注册中心注销
+	server.HeartBeat(registryAddr, "tcp@"+l.Addr().String(), 0)
 	wg.Done()
 	server.Accept(l)
 }
@@ -64,6 +65,8 @@ func call(registry string) {
 	d := xclient.NewRegistryDiscovery(registry, 0)
 	xc := xclient.NewXClient(d, xclient.RandomSelect, nil)
 	defer func() { _ = xc.Close() }()
+	// 服务端上下线时换一个服务端重试
+	xc.SetFailOption(xclient.FailOption{Mode: xclient.Failover, Retries: 2})
 	// send request & receive response
 	var wg sync.WaitGroup
 	for i := 0; i < 5; i++ {
@@ -87,7 +90,8 @@ func broadcast(registry string) {
 			defer wg.Done()
 			foo(xc, context.Background(), "broadcast", "Foo.Sum", &Args{Num1: i, Num2: i * i})
 			// expect 2 - 5 timeout
-			ctx, _ := context.WithTimeout(context.Background(), time.Second*2)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
 			foo(xc, ctx, "broadcast", "Foo.Sleep", &Args{Num1: i, Num2: i * i})
 		}(i)
 	}
@@ -0,0 +1,144 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 22:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package metadata
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// MD 随调用一起发送的键值对 键统一转成小写
+// 请求中的MD是客户端发给服务端的header 回复中的MD是服务端返回的trailer
+type MD map[string]string
+
+// New 从map创建MD
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md.Set(k, v)
+	}
+	return md
+}
+
+// Pairs 从键值对创建MD 参数个数必须是偶数
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic("metadata: Pairs got an odd number of arguments")
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md.Set(kv[i], kv[i+1])
+	}
+	return md
+}
+
+func (md MD) Get(key string) string {
+	return md[strings.ToLower(key)]
+}
+
+func (md MD) Set(key, value string) {
+	md[strings.ToLower(key)] = value
+}
+
+func (md MD) Copy() MD {
+	return Join(md)
+}
+
+// Join 合并多个MD 后面的值覆盖前面的值
+func Join(mds ...MD) MD {
+	out := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type outgoingKey struct{}
+
+type incomingKey struct{}
+
+type trailerKey struct{}
+
+type serverTrailerKey struct{}
+
+// NewOutgoingContext 客户端使用 这个context中发起的调用会带上md
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext 在已有的outgoing md上追加键值对
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+// FromOutgoingContext 取出客户端要发送的md
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext 服务端使用 把客户端发来的md放入请求的context
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext 服务方法和拦截器读取客户端发来的md
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
+
+// ReceiveTrailer 客户端使用 调用完成后把服务端返回的trailer写入md
+func ReceiveTrailer(ctx context.Context, md *MD) context.Context {
+	return context.WithValue(ctx, trailerKey{}, md)
+}
+
+// TrailerTarget 取出ReceiveTrailer设置的目标 没有设置时返回nil
+func TrailerTarget(ctx context.Context) *MD {
+	md, _ := ctx.Value(trailerKey{}).(*MD)
+	return md
+}
+
+// ErrNoTrailer context不是服务端请求的context 无法设置trailer
+var ErrNoTrailer = errors.New("metadata: context has no server trailer")
+
+// ServerTrailer 服务端一次调用的trailer 方法返回后随回复一起发给客户端
+type ServerTrailer struct {
+	mu sync.Mutex
+	md MD
+}
+
+// NewServerTrailerContext 服务端为每个请求创建trailer
+func NewServerTrailerContext(ctx context.Context) (context.Context, *ServerTrailer) {
+	t := &ServerTrailer{}
+	return context.WithValue(ctx, serverTrailerKey{}, t), t
+}
+
+// MD 当前设置的trailer
+func (t *ServerTrailer) MD() MD {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.md
+}
+
+// SetTrailer 服务方法设置trailer 多次调用会合并
+func SetTrailer(ctx context.Context, md MD) error {
+	t, ok := ctx.Value(serverTrailerKey{}).(*ServerTrailer)
+	if !ok {
+		return ErrNoTrailer
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.md = Join(t.md, md)
+	return nil
+}
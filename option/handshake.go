@@ -0,0 +1,70 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 13:05
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package option
+
+import "time"
+
+// HandshakeTimeout 等待握手应答的最长时间 设置了ConnectTimeOut时不超过它的一半
+// 还没有升级的服务端不会回复握手 超时后客户端会用LegacyVersion重新连接
+var HandshakeTimeout = 5 * time.Second
+
+// 握手时可以协商的能力
+const (
+	FeatureFrame     = "frame"     // 帧模式
+	FeatureCancel    = "cancel"    // 客户端可以发送取消消息
+	FeatureDrain     = "drain"     // 客户端可以识别服务端关闭前的通知
+	FeatureStreaming = "streaming" // 流式调用
+)
+
+// DefaultFeatures 客户端默认声明的能力
+var DefaultFeatures = []string{FeatureCancel, FeatureDrain, FeatureStreaming}
+
+// Handshake 服务端收到option之后的应答 告诉客户端最终选择的协议版本 编码方式和能力
+type Handshake struct {
+	Version   int      // 双方都支持的协议版本
+	CodecType string   // 选择的编码类型
+	FrameMode bool     // 是否使用帧模式
+	Features  []string // 双方都支持的能力
+	Compress  string   // 选择的压缩算法 为空表示不压缩
+	Err       string   // 不为空说明服务端拒绝了这次连接
+}
+
+// HandshakeError 服务端拒绝握手时客户端返回的错误
+type HandshakeError struct {
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return "rpc handshake rejected: " + e.Reason
+}
+
+// Legacy 判断是否是不需要握手应答的旧版本
+func (o *Option) Legacy() bool {
+	return o.Version <= 0
+}
+
+// HasFeature 判断能力列表中是否包含某项能力
+func HasFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply 把握手结果应用到option上 返回一个新的option
+func (h *Handshake) Apply(opt *Option) *Option {
+	o := *opt
+	o.Version = h.Version
+	o.CodecType = h.CodecType
+	o.FrameMode = h.FrameMode
+	o.Features = h.Features
+	o.compress = h.Compress
+	return &o
+}
@@ -0,0 +1,27 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 16:50
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package option
+
+import "context"
+
+// Invoker 发起一次调用
+type Invoker func(ctx context.Context, serviceMethod string, args, reply interface{}) error
+
+// Interceptor 客户端拦截器 调用invoker继续发送请求 可以在前后加入重试 统计 日志等逻辑
+type Interceptor func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error
+
+// ChainInterceptors 把拦截器串起来 第一个拦截器最先执行
+func ChainInterceptors(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+			return interceptor(ctx, serviceMethod, args, reply, next)
+		}
+	}
+	return invoker
+}
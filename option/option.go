@@ -8,20 +8,76 @@
 package option
 
 import (
+	"crypto/tls"
+	"net"
 	"rpc/codec"
 	"time"
 )
 
 const MagicNumber = 0x123456
 
+const (
+	ProtocolVersion = 1  // 当前的协议版本
+	LegacyVersion   = -1 // 不进行握手应答 用于连接还没有升级的服务端
+)
+
 type Option struct {
-	MagicNumber    uint64        // 魔法数字
-	CodecType      string        // 编码器的类型
-	ConnectTimeOut time.Duration // 连接超时时间
-	HandleTimeOut  time.Duration
+	MagicNumber       uint64        // 魔法数字
+	CodecType         string        // 编码器的类型
+	ConnectTimeOut    time.Duration // 连接超时时间
+	HandleTimeOut     time.Duration
+	FrameMode         bool     // 是否使用帧模式 默认是流模式
+	Version           int      // 协议版本 为0时使用当前版本
+	Codecs            []string // 客户端支持的编码类型 按优先级排列 为空时只使用CodecType
+	Features          []string // 客户端支持的能力
+	Compressors       []string // 客户端支持的压缩算法 按优先级排列
+	CompressThreshold int      // body超过这个长度才压缩 为0时使用默认值
+	Token             string   // 握手时发给服务端的凭证 服务端配置了认证时使用
+
+	// compress 握手协商后使用的压缩算法 为空表示不压缩 只能由握手应答设置
+	// 没有收到应答的旧版本连接不会压缩
+	compress string
+
+	Interceptors []Interceptor `json:"-"` // 客户端拦截器 只在本地生效 不会发给服务端
+	TLSConfig    *tls.Config   `json:"-"` // 不为空时使用TLS连接 ServerName为空时使用地址中的主机名
 }
 
 var DefaultOption = &Option{
 	MagicNumber: MagicNumber,
 	CodecType:   codec.GobType,
+	Version:     ProtocolVersion,
+	Features:    DefaultFeatures,
 } // 默认选项 方便用户使用
+
+// NewCodecFunc 根据编码类型和传输模式返回编码器的构造函数 不支持的话返回nil
+func (o *Option) NewCodecFunc() codec.NewCodecFunc {
+	f := codec.NewCodecFuncMap[o.CodecType]
+	codecType := o.CodecType
+	if o.FrameMode {
+		if _, ok := codec.SerializerMap[codecType]; !ok {
+			return nil
+		}
+		f = func(conn net.Conn) codec.Codec {
+			return codec.NewFrameCodec(conn, codecType)
+		}
+	}
+	if f == nil || o.compress == "" {
+		return f
+	}
+	// 压缩需要先把body序列化成字节
+	if _, ok := codec.CompressorMap[o.compress]; !ok {
+		return nil
+	}
+	if _, ok := codec.SerializerMap[codecType]; !ok {
+		return nil
+	}
+	compress, threshold := o.compress, o.CompressThreshold
+	return func(conn net.Conn) codec.Codec {
+		return codec.NewCompressCodec(f(conn), codecType, compress, threshold)
+	}
+}
+
+// Compress 协商后使用的压缩算法 为空表示不压缩
+func (o *Option) Compress() string {
+	return o.compress
+}
@@ -0,0 +1,46 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 20:10
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package option
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// ErrTLSConfigRequired 使用tls@地址时没有配置TLSConfig
+var ErrTLSConfigRequired = errors.New("rpc option: tls config is required")
+
+// LoadTLSConfig 从PEM文件中加载TLS配置 客户端和服务端都可以使用
+// certFile和keyFile是自己的证书 为空时不带证书
+// caFile用来校验对端的证书 客户端用来校验服务端 服务端用来校验客户端证书
+// 服务端需要客户端证书时 再设置ClientAuth为tls.RequireAndVerifyClientCert
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("rpc option: no certificate found in " + caFile)
+		}
+		config.RootCAs = pool
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
@@ -52,6 +52,12 @@ func (r *Registry) putServer(addr string) {
 	}
 }
 
+func (r *Registry) deleteServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.serverItems, addr)
+}
+
 func (r *Registry) aliveServers() []string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -83,6 +89,15 @@ func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 		r.putServer(addr)
+	case "DELETE":
+		// 服务端关闭时主动注销
+		addr := req.Header.Get("X-RPC-Server")
+		if addr == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			logger.Logger.Println("have no addr")
+			return
+		}
+		r.deleteServer(addr)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -96,36 +111,58 @@ func HandleHTTP() {
 	DefaultRegistry.HandleHTTP(defaultPath)
 }
 
-func HeartBeat(register, address string, duration time.Duration) {
-	// 默认周期比超时周期少1分钟
+// HeartBeat 定时向注册中心发送心跳 返回的函数用来停止发送
+func HeartBeat(register, address string, duration time.Duration) (stop func()) {
+	// 默认周期比超时周期少1秒
 	if duration == 0 {
-		duration = defaultTimeOut - time.Duration(1)*time.Minute
+		duration = defaultTimeOut - time.Second
 	}
 	// 心跳检测  设置一个定时器 每duration时间发送一次心跳检测包
 	var err error
 	err = sendHeatBeat(register, address)
+	done := make(chan struct{})
 	go func() {
-		ticker := time.NewTimer(duration)
+		ticker := time.NewTicker(duration)
 		defer ticker.Stop()
 		for err == nil {
-			<-ticker.C
-			err = sendHeatBeat(register, address)
+			select {
+			case <-ticker.C:
+				err = sendHeatBeat(register, address)
+			case <-done:
+				return
+			}
 		}
 	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
 }
 
 func sendHeatBeat(registry, address string) error {
 	logger.Logger.Println(address, "send heart beat to registry", registry)
+	return sendRequest("POST", registry, address)
+}
+
+// Unregister 从注册中心删除服务地址
+func Unregister(registry, address string) error {
+	logger.Logger.Println(address, "unregister from registry", registry)
+	return sendRequest("DELETE", registry, address)
+}
+
+func sendRequest(method, registry, address string) error {
 	client := http.Client{}
-	req, err := http.NewRequest("POST", registry, nil)
+	req, err := http.NewRequest(method, registry, nil)
 	if err != nil {
 		logger.Logger.Println("create new request fail,err:", err)
 		return err
 	}
 	req.Header.Set("X-RPC-Server", address)
-	if _, err = client.Do(req); err != nil {
+	resp, err := client.Do(req)
+	if err != nil {
 		logger.Logger.Println("get response fail,err:", err)
 		return err
 	}
+	_ = resp.Body.Close()
 	return nil
 }
@@ -0,0 +1,55 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 21:05
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package server
+
+import (
+	"rpc/auth"
+	"rpc/codec"
+	"rpc/health"
+)
+
+// authenticateConn 握手时校验option中的token或者客户端证书 得到连接的身份
+// 客户端没有带token时不拒绝连接 之后的请求可以在header中单独带token
+func (s *Server) authenticateConn(token string, peer *Peer) error {
+	if s.Auth == nil {
+		return nil
+	}
+	principal, err := s.Auth.Authenticate(&auth.Credentials{Token: token, TLS: peer.TLS})
+	if err != nil {
+		if token != "" {
+			return err
+		}
+		return nil
+	}
+	peer.Principal = principal
+	return nil
+}
+
+// authorize 确定请求的调用方并检查ACL 请求header中的token优先于连接的身份
+// 健康检查不受ACL限制 只要求通过认证
+func (s *Server) authorize(peer *Peer, h *codec.Header) (string, error) {
+	if s.Auth == nil && s.ACL == nil {
+		return "", nil
+	}
+	principal := peer.Principal
+	if h.Auth != "" && s.Auth != nil {
+		var err error
+		if principal, err = s.Auth.Authenticate(&auth.Credentials{Token: h.Auth, TLS: peer.TLS}); err != nil {
+			return "", err
+		}
+	}
+	if principal == "" {
+		return "", auth.ErrUnauthenticated
+	}
+	if s.ACL != nil && h.ServiceMethod != health.CheckMethod {
+		if err := s.ACL.Check(principal, h.ServiceMethod); err != nil {
+			return "", err
+		}
+	}
+	return principal, nil
+}
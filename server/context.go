@@ -0,0 +1,140 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 15:00
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"rpc/codec"
+	"sync"
+	"time"
+)
+
+// Peer 连接对端的信息
+type Peer struct {
+	Addr net.Addr             // 客户端地址
+	TLS  *tls.ConnectionState // TLS连接的状态 明文连接时为nil
+	// Principal 握手时认证得到的身份 没有认证时为空
+	Principal string
+}
+
+// Certificate 客户端的证书 没有使用双向TLS时返回nil
+func (p *Peer) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return p.TLS.PeerCertificates[0]
+}
+
+// CallInfo 当前调用的信息 服务方法可以从context中取出
+type CallInfo struct {
+	ServiceMethod string    // 调用的服务方法
+	Seq           uint64    // 请求的序列号
+	Deadline      time.Time // 客户端的截止时间 为零值表示客户端没有设置
+	Principal     string    // 调用方的身份 服务端没有配置认证时为空
+}
+
+type peerKey struct{}
+
+type callInfoKey struct{}
+
+func newPeerContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext 从context中取出对端信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+func newCallContext(ctx context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFromContext 从context中取出当前调用的信息
+func CallInfoFromContext(ctx context.Context) (*CallInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info, ok
+}
+
+// callSet 一个连接上正在处理的请求 用来响应客户端的取消消息
+// 请求从读出到处理函数返回都在集合中 关闭时据此判断连接是否空闲
+type callSet struct {
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc
+	closed  bool // 连接已经因为空闲被关闭 不再接收新的请求
+}
+
+func newCallSet() *callSet {
+	return &callSet{cancels: make(map[uint64]context.CancelFunc)}
+}
+
+// add 为请求创建context 截止时间取服务端超时时间和客户端截止时间中较早的一个
+// 连接已经被关闭时返回false
+func (cs *callSet) add(ctx context.Context, h *codec.Header, principal string, timeout time.Duration) (context.Context, bool) {
+	info := &CallInfo{ServiceMethod: h.ServiceMethod, Seq: h.Seq, Principal: principal}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if h.Timeout > 0 {
+		info.Deadline = time.Now().Add(h.Timeout)
+		if deadline.IsZero() || info.Deadline.Before(deadline) {
+			deadline = info.Deadline
+		}
+	}
+	ctx = newCallContext(ctx, info)
+	var cancel context.CancelFunc
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		cancel()
+		return nil, false
+	}
+	cs.cancels[h.Seq] = cancel
+	return ctx, true
+}
+
+// cancel 取消请求的context 请求仍然算作正在处理 直到处理函数返回后调用remove
+func (cs *callSet) cancel(seq uint64) {
+	cs.mu.Lock()
+	cancel := cs.cancels[seq]
+	cs.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// remove 请求处理完毕 释放context
+func (cs *callSet) remove(seq uint64) {
+	cs.mu.Lock()
+	cancel := cs.cancels[seq]
+	delete(cs.cancels, seq)
+	cs.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// closeIfIdle 没有正在处理的请求时标记连接关闭 和add互斥 返回是否已经关闭
+func (cs *callSet) closeIfIdle() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.cancels) == 0 {
+		cs.closed = true
+	}
+	return cs.closed
+}
@@ -0,0 +1,66 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 16:00
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package server
+
+import (
+	"context"
+	"rpc/codec"
+)
+
+// RequestInfo 拦截器能够看到的请求信息
+type RequestInfo struct {
+	ServiceMethod string        // 服务名+方法名
+	Header        *codec.Header // 请求头
+	Args          interface{}   // 参数 总是指针类型 拦截器可以修改或者替换成同类型的指针
+	Reply         interface{}   // 返回值 总是指针类型 可以替换成同类型的指针 回复的是替换后的值
+}
+
+// Handler 处理一个请求
+type Handler func(ctx context.Context, info *RequestInfo) error
+
+// Interceptor 拦截器 调用next继续处理 不调用的话请求在这里结束
+type Interceptor func(ctx context.Context, info *RequestInfo, next Handler) error
+
+// Use 注册全局拦截器 按注册的顺序执行
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// UseService 注册只对某个服务生效的拦截器 在全局拦截器之后执行
+func (s *Server) UseService(serviceName string, interceptors ...Interceptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serviceInterceptors[serviceName] = append(s.serviceInterceptors[serviceName], interceptors...)
+}
+
+func Use(interceptors ...Interceptor) {
+	DefaultServer.Use(interceptors...)
+}
+
+func UseService(serviceName string, interceptors ...Interceptor) {
+	DefaultServer.UseService(serviceName, interceptors...)
+}
+
+// chain 把服务对应的拦截器串起来 最后调用handler
+func (s *Server) chain(serviceName string, handler Handler) Handler {
+	s.mu.RLock()
+	interceptors := make([]Interceptor, 0, len(s.interceptors)+len(s.serviceInterceptors[serviceName]))
+	interceptors = append(interceptors, s.interceptors...)
+	interceptors = append(interceptors, s.serviceInterceptors[serviceName]...)
+	s.mu.RUnlock()
+	// 从后往前包装 保证第一个注册的拦截器最先执行
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, info *RequestInfo) error {
+			return interceptor(ctx, info, next)
+		}
+	}
+	return handler
+}
@@ -8,6 +8,8 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,10 +18,15 @@ import (
 	"net"
 	"net/http"
 	"reflect"
+	"rpc/auth"
 	"rpc/codec"
+	"rpc/health"
 	"rpc/logger"
+	"rpc/metadata"
 	"rpc/option"
 	"rpc/service"
+	"rpc/status"
+	rtdebug "runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -32,7 +39,21 @@ const (
 )
 
 type Server struct {
-	ServiceMap *sync.Map // 段锁map
+	ServiceMap          *sync.Map                // 段锁map
+	CrashOnPanic        bool                     // 服务方法panic时是否让进程崩溃 默认恢复并返回错误 测试时可以打开
+	Auth                auth.Authenticator       // 不为空时校验客户端的凭证
+	ACL                 *auth.ACL                // 不为空时检查调用方能否调用请求的方法
+	Health              *health.Server           // 内置健康检查服务的状态 注册的服务默认是Serving
+	HandshakeTimeout    time.Duration            // TLS握手和读取option的最长时间 为0时使用option.HandshakeTimeout
+	mu                  sync.RWMutex             // 保护拦截器
+	interceptors        []Interceptor            // 全局拦截器
+	serviceInterceptors map[string][]Interceptor // 每个服务单独的拦截器
+
+	connMu     sync.Mutex                // 保护下面的字段
+	inShutdown int32                     // 是否正在关闭
+	listeners  map[net.Listener]struct{} // 正在使用的监听器
+	conns      map[*serverConn]struct{}  // 正在服务的连接
+	onShutdown []func()                  // 关闭时执行的函数
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -73,40 +94,50 @@ func (s *Server) HandleHTTP() {
 }
 
 func NewServer() *Server {
-	return &Server{
-		ServiceMap: new(sync.Map), // 初始化
+	s := &Server{
+		ServiceMap:          new(sync.Map), // 初始化
+		Health:              health.NewServer(),
+		serviceInterceptors: make(map[string][]Interceptor),
+		listeners:           make(map[net.Listener]struct{}),
+		conns:               make(map[*serverConn]struct{}),
 	}
+	// 每个服务端都提供健康检查 客户端可以用来主动探测
+	hs := service.NewService(health.NewHealth(s.Health))
+	hs.Name = health.ServiceName
+	s.ServiceMap.Store(hs.Name, hs)
+	return s
 }
 
 func (s *Server) RegisterService(ins interface{}) {
 	service := service.NewService(ins)              // 注册服务
 	s.ServiceMap.LoadOrStore(service.Name, service) // 载入全局MAP
+	s.Health.SetServingStatus(service.Name, health.Serving)
 }
 
 func RegisterService(ins interface{}) {
-	service := service.NewService(ins)
-	// 注册服务
-	DefaultServer.ServiceMap.LoadOrStore(service.Name, service) // 载入全局MAP
+	DefaultServer.RegisterService(ins)
 }
 
 // 发现服务
 func (s *Server) findService(serviceMethod string) (*service.Service, *service.Method, error) {
-	strArr := strings.Split(serviceMethod, ".")
-	if len(strArr) != 2 {
+	// 按最后一个点分开 内置服务的名字里带点 例如rpc.Health.Check
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot <= 0 || dot == len(serviceMethod)-1 {
 		logger.Logger.Println("the format of serviceMethod is wrong")
-		return nil, nil, errors.New("the format of serviceMethod is wrong")
+		return nil, nil, status.New(status.InvalidArgument, "the format of serviceMethod is wrong")
 	}
+	strArr := []string{serviceMethod[:dot], serviceMethod[dot+1:]}
 	if val, ok := s.ServiceMap.Load(strArr[0]); ok {
 		service := val.(*service.Service)
 		method := service.Methods[strArr[1]]
 		if method == nil {
 			logger.Logger.Println("rpc server: can't find method " + strArr[1])
-			return nil, nil, errors.New("rpc server: can't find method " + strArr[1])
+			return nil, nil, status.New(status.NotFound, "rpc server: can't find method "+strArr[1])
 		}
 		return service, method, nil
 	}
 	logger.Logger.Println("the service is not registered")
-	return nil, nil, errors.New("the service is not registered")
+	return nil, nil, status.New(status.NotFound, "the service is not registered")
 }
 
 var DefaultServer = NewServer()
@@ -115,59 +146,214 @@ func Accept(lis net.Listener) {
 	DefaultServer.Accept(lis)
 }
 
+// Accept 接收连接 监听器关闭之后返回
 func (s *Server) Accept(lis net.Listener) {
+	if !s.trackListener(lis, true) {
+		_ = lis.Close()
+		return
+	}
+	defer s.trackListener(lis, false)
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			logger.Logger.Fatal("listener get conn fail,exit")
+			if !s.shuttingDown() {
+				logger.Logger.Println("listener get conn fail,exit:", err)
+			}
+			return
 		}
 		go s.serveConn(conn) // 单独开启一个协程处理该连接的请求
 	}
 }
 
+// AcceptTLS 在lis上接收TLS连接 需要客户端证书时把config.ClientAuth设置为tls.RequireAndVerifyClientCert
+func (s *Server) AcceptTLS(lis net.Listener, config *tls.Config) {
+	s.Accept(tls.NewListener(lis, config))
+}
+
+func AcceptTLS(lis net.Listener, config *tls.Config) {
+	DefaultServer.AcceptTLS(lis, config)
+}
+
 func (s *Server) serveConn(conn net.Conn) {
+	peer := &Peer{Addr: conn.RemoteAddr()}
+	// 连接后什么都不发送的客户端不能一直占用协程和连接 TLS握手和读取option都要在限定时间内完成
+	timeout := s.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = option.HandshakeTimeout
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// 先完成TLS握手 才能拿到客户端的证书
+		if err := tlsConn.Handshake(); err != nil {
+			logger.Logger.Println("rpc server: tls handshake fail,err:", err)
+			_ = conn.Close()
+			return
+		}
+		state := tlsConn.ConnectionState()
+		peer.TLS = &state
+	}
 	decoder := json.NewDecoder(conn) // 封装conn为一个json解码器
 	var opt option.Option            // 读取出数据并将能够解析的第一个json进行解析成结构体
 	err := decoder.Decode(&opt)
 	if err != nil {
 		logger.Logger.Println("parse json to option fail") // 解析失败直接退出
+		_ = conn.Close()
 		return
 	}
-	if opt.MagicNumber != opt.MagicNumber {
-		logger.Logger.Println("MagicNumber is false") // 解析失败直接退出
-		return
+	_ = conn.SetDeadline(time.Time{})
+	hs := s.handshake(&opt)
+	if hs.Err == "" {
+		if err = s.authenticateConn(opt.Token, peer); err != nil {
+			hs.Err = err.Error()
+		}
 	}
-	if f, ok := codec.NewCodecFuncMap[opt.CodecType]; ok {
-		// FIXME
-		s.serveCodec(f(conn), &opt)
-		return
-	} else {
-		logger.Logger.Println("UnSupported Codec Type")
+	if !opt.Legacy() {
+		// 新版本的客户端需要等待握手应答
+		if err = json.NewEncoder(conn).Encode(hs); err != nil {
+			logger.Logger.Println("write handshake fail,err:", err)
+			_ = conn.Close()
+			return
+		}
+	}
+	if hs.Err != "" {
+		logger.Logger.Println("rpc server: handshake rejected:", hs.Err)
+		_ = conn.Close()
 		return
 	}
+	opt = *hs.Apply(&opt)
+	// json解码器可能多读了option后面的数据 需要先把缓存的数据交给编码器
+	ctx := newPeerContext(context.Background(), peer)
+	s.serveCodec(ctx, opt.NewCodecFunc()(codec.NewBufferedConn(conn, decoder.Buffered())), &opt)
+}
+
+// serverFeatures 服务端支持的能力
+var serverFeatures = []string{option.FeatureFrame, option.FeatureCancel, option.FeatureDrain, option.FeatureStreaming}
+
+// handshake 根据客户端的option选出双方都支持的协议版本 编码方式和能力
+func (s *Server) handshake(opt *option.Option) *option.Handshake {
+	hs := &option.Handshake{Version: opt.Version}
+	if opt.MagicNumber != option.MagicNumber {
+		hs.Err = "invalid magic number"
+		return hs
+	}
+	if hs.Version > option.ProtocolVersion {
+		// 客户端版本更高时降级到服务端的版本
+		hs.Version = option.ProtocolVersion
+	}
+	for _, f := range opt.Features {
+		if option.HasFeature(serverFeatures, f) {
+			hs.Features = append(hs.Features, f)
+		}
+	}
+	// 帧模式需要双方都声明 旧版本的客户端收不到应答 只能按它自己的设置
+	hs.FrameMode = opt.FrameMode
+	if !opt.Legacy() {
+		hs.FrameMode = option.HasFeature(hs.Features, option.FeatureFrame)
+	}
+	codecs := opt.Codecs
+	if len(codecs) == 0 {
+		codecs = []string{opt.CodecType}
+	}
+	for _, typ := range codecs {
+		candidate := option.Option{CodecType: typ, FrameMode: hs.FrameMode}
+		if candidate.NewCodecFunc() != nil {
+			hs.CodecType = typ
+			break
+		}
+	}
+	if hs.CodecType == "" {
+		hs.Err = fmt.Sprintf("unsupported codec type %v", codecs)
+		return hs
+	}
+	// 旧版本的客户端收不到握手应答 不能使用压缩
+	if !opt.Legacy() {
+		for _, name := range opt.Compressors {
+			if _, ok := codec.CompressorMap[name]; ok {
+				hs.Compress = name
+				break
+			}
+		}
+	}
+	return hs
 }
 
 var invalidRequest = struct{}{}
 
-func (s *Server) serveCodec(c codec.Codec, opt *option.Option) {
+func (s *Server) serveCodec(ctx context.Context, c codec.Codec, opt *option.Option) {
 	// 只传输一个option 后面接上多个 header和body是有可能的
 	sending := new(sync.Mutex)
 	wg := new(sync.WaitGroup)
+	// 连接断开之后取消所有还在处理的请求
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	calls := newCallSet()
+	peer, ok := PeerFromContext(ctx)
+	if !ok {
+		peer = &Peer{}
+	}
+	sc := &serverConn{
+		c:       c,
+		sending: sending,
+		calls:   calls,
+		drain:   option.HasFeature(opt.Features, option.FeatureDrain),
+		streams: make(map[uint64]*serverStream),
+	}
+	if !s.trackConn(sc, true) {
+		_ = c.Close()
+		return
+	}
+	defer s.trackConn(sc, false)
 	// 代码会一次性读取出多个请求 然后退出for循环 卡在wait上 等所有的请求全部处理完毕再退出函数
 	for {
-		request, err := s.readRequest(c)
+		request, err := s.readRequest(c, peer)
 		if err != nil {
 			if request == nil {
 				// 如果请求为空说明header就没有解析成功 即时让循环重新再来一次 后面的请求也不可能解析成功
 				break
 			}
-			request.header.Err = err.Error()
-			s.sendResponse(c, request.header, invalidRequest, sending)
+			s.sendError(c, request.header, err, sending)
+			continue
+		}
+		if request.header.Flags&codec.FlagCancel != 0 {
+			// 客户端放弃了这个请求
+			calls.cancel(request.header.Seq)
+			continue
+		}
+		if request.header.Flags&codec.FlagWindowUpdate != 0 {
+			sc.addCredit(request.header)
+			continue
+		}
+		if isStreamMessage(request.header) {
+			if err = sc.receiveStream(request.header); err != nil {
+				break
+			}
+			continue
+		}
+		// 先登记请求再检查是否正在关闭 关闭时不会把有请求登记的连接当作空闲连接关掉
+		reqCtx, ok := calls.add(metadata.NewIncomingContext(ctx, request.md), request.header, request.principal, opt.HandleTimeOut)
+		if !ok {
+			// 连接已经因为空闲被关闭
+			break
+		}
+		if s.shuttingDown() {
+			// 正在关闭 拒绝新的请求 客户端可以换一个服务端重试
+			calls.remove(request.header.Seq)
+			s.sendError(c, request.header, ErrServerClosed, sending)
 			continue
 		}
+		reqCtx, request.trailer = metadata.NewServerTrailerContext(reqCtx)
+		if request.stream {
+			request.ss = sc.openStream(reqCtx, request)
+		}
 		wg.Add(1)
-		go s.handleRequest(c, request, sending, wg, opt.HandleTimeOut)
+		go func(request *Request) {
+			// 处理完毕后释放context和流
+			defer calls.remove(request.header.Seq)
+			defer sc.removeStream(request.header.Seq)
+			s.handleRequest(reqCtx, c, request, sending, wg, opt.HandleTimeOut)
+		}(request)
 	}
+	cancel()
 	wg.Wait()
 	_ = c.Close()
 }
@@ -177,6 +363,11 @@ type Request struct {
 	args, reply reflect.Value // 参数和回复 反射值
 	service     *service.Service
 	methodName  string
+	stream      bool          // 是否是流式方法
+	ss          *serverStream // 流式方法对应的流
+	md          metadata.MD   // 客户端发来的metadata
+	trailer     *metadata.ServerTrailer
+	principal   string // 通过认证的调用方
 }
 
 func (s *Server) readRequestHeader(c codec.Codec) (*codec.Header, error) {
@@ -187,27 +378,55 @@ func (s *Server) readRequestHeader(c codec.Codec) (*codec.Header, error) {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
 			log.Println("rpc server: read header error:", err)
 		}
-		return nil, err
+		return &header, err
 	}
 	return &header, nil
 }
 
-func (s *Server) readRequest(c codec.Codec) (*Request, error) {
+func (s *Server) readRequest(c codec.Codec, peer *Peer) (*Request, error) {
 	header, err := s.readRequestHeader(c)
 	if err != nil {
-		//logger.Logger.Println("read header fail,err:", err)
+		// 帧模式下header解析失败不影响后面的帧 可以回复错误后继续处理
+		if codec.IsBodyError(err) {
+			return &Request{header: header}, bodyStatus(err)
+		}
 		return nil, err
 	}
-	request := &Request{header: header}
+	// metadata单独保存 回复时header中只带服务端的trailer
+	request := &Request{header: header, md: header.Metadata}
+	header.Metadata = nil
+	if header.Flags&(codec.FlagCancel|codec.FlagWindowUpdate) != 0 {
+		// 控制消息没有参数
+		return request, c.ReadBody(nil)
+	}
+	if isStreamMessage(header) {
+		// 流中的后续消息 body由对应的流读取
+		return request, nil
+	}
+	// 查找服务和解析参数之前先鉴权 未授权的调用方不能通过错误码探测方法是否存在
+	if request.principal, err = s.authorize(peer, header); err != nil {
+		_ = c.ReadBody(nil)
+		return request, err
+	}
 	service, methodType, err := s.findService(header.ServiceMethod)
 	if service == nil || methodType == nil {
 		logger.Logger.Println(" find service fail err:", err)
+		// 找不到服务也要把body读出来 否则后面的消息会错位
+		_ = c.ReadBody(nil)
 		return request, err
 	}
+	if methodType.Stream != (header.Flags&codec.FlagStreamData != 0) {
+		// 流式方法只能用流式调用 普通方法也不能用流式调用
+		_ = c.ReadBody(nil)
+		return request, status.Errorf(status.Unimplemented, "rpc server: %s streaming mismatch, method streaming: %v", header.ServiceMethod, methodType.Stream)
+	}
 	request.args = methodType.NewArgs()
-	request.reply = methodType.NewReply()
+	if !methodType.Stream {
+		request.reply = methodType.NewReply()
+	}
 	request.service = service
 	request.methodName = methodType.Method.Name
+	request.stream = methodType.Stream
 	//request.args = reflect.New(reflect.TypeOf(""))
 	argsi := request.args.Interface()
 	if request.args.Type().Kind() != reflect.Ptr {
@@ -218,40 +437,113 @@ func (s *Server) readRequest(c codec.Codec) (*Request, error) {
 	if err != nil {
 		logger.Logger.Println(" read args err:", err)
 		// header解析出来了 但是body解析错误 这种情况下爱仍然可以继续处理请求
-		return request, err
+		return request, bodyStatus(err)
 	}
 	return request, nil
 }
 
-func (s *Server) handleRequest(c codec.Codec, request *Request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
+// values 取出info中的参数和返回值 拦截器替换后的类型必须和方法的参数一致
+func (request *Request) values(info *RequestInfo) (args, reply reflect.Value, err error) {
+	args = reflect.ValueOf(info.Args)
+	if request.args.Type().Kind() != reflect.Ptr && args.Kind() == reflect.Ptr && !args.IsNil() {
+		args = args.Elem()
+	}
+	reply = reflect.ValueOf(info.Reply)
+	if !args.IsValid() || args.Type() != request.args.Type() || !reply.IsValid() || reply.Type() != request.reply.Type() {
+		return args, reply, status.Errorf(status.Internal, "rpc server: %s args or reply replaced with a wrong type", info.ServiceMethod)
+	}
+	return args, reply, nil
+}
+
+// bodyStatus 消息解析失败时的错误码 帧太大时是ResourceExhausted
+func bodyStatus(err error) error {
+	if errors.Is(err, codec.ErrFrameTooLarge) {
+		return status.New(status.ResourceExhausted, err.Error())
+	}
+	return status.New(status.InvalidArgument, err.Error())
+}
+
+func (s *Server) handleRequest(ctx context.Context, c codec.Codec, request *Request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
 	defer wg.Done()
-	ch := make(chan struct{})
-	send := make(chan struct{})
-	go func() {
-		err := request.service.Call(request.methodName, request.args, request.reply)
-		ch <- struct{}{}
+	stream := request.ss
+	// 回复的标记由服务端决定 不沿用请求中的标记
+	request.header.Flags = 0
+	if stream != nil {
+		// 流式方法返回之后发送一个关闭消息 表示流结束
+		request.reply = reflect.ValueOf(stream)
+		request.header.Flags = codec.FlagStreamData | codec.FlagStreamClose
+		request.header.StreamID = request.header.Seq
+		defer stream.close()
+	}
+	argsi := request.args.Interface()
+	if request.args.Type().Kind() != reflect.Ptr {
+		argsi = request.args.Addr().Interface()
+	}
+	info := &RequestInfo{
+		ServiceMethod: request.header.ServiceMethod,
+		Header:        request.header,
+		Args:          argsi,
+		Reply:         request.reply.Interface(),
+	}
+	handler := s.chain(request.service.Name, func(ctx context.Context, info *RequestInfo) error {
+		// 拦截器可能替换了参数和返回值 使用info中的值调用方法
+		args, reply, err := request.values(info)
 		if err != nil {
-			request.header.Err = err.Error()
+			return err
 		}
-		s.sendResponse(c, request.header, request.reply.Interface(), sending)
-		send <- struct{}{}
+		request.reply = reply
+		return request.service.CallContext(ctx, request.methodName, args, reply)
+	})
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if s.CrashOnPanic {
+				return
+			}
+			// 一个请求panic不能影响整个服务端
+			if r := recover(); r != nil {
+				logger.Logger.Printf("rpc server: %s panic: %v\n%s", info.ServiceMethod, r, rtdebug.Stack())
+				done <- status.Errorf(status.Internal, "rpc server: %s panic: %v", info.ServiceMethod, r)
+			}
+		}()
+		done <- handler(ctx, info)
 	}()
-	// FIXME
-	if timeout == 0 {
-		<-ch
-		<-send
-		return
-	}
 	select {
-	// FIXME
-	case <-time.After(timeout):
-		request.header.Err = fmt.Sprintf("rpc server: request handle timeout: expect within 1")
-		s.sendResponse(c, request.header, invalidRequest, sending)
-		return
-	case <-ch:
-		<-send
+	case err := <-done:
+		request.header.Metadata = request.trailer.MD()
+		if stream != nil {
+			stream.close()
+		}
+		if err != nil {
+			s.sendError(c, request.header, err, sending)
+			return
+		}
+		if stream != nil {
+			s.sendResponse(c, request.header, invalidRequest, sending)
+			return
+		}
+		s.sendResponse(c, request.header, request.reply.Interface(), sending)
+	case <-ctx.Done():
+		// 处理函数可能还在运行 等它返回后才算请求结束 关闭时会等待这些请求
+		defer func() { <-done }()
+		call, _ := CallInfoFromContext(ctx)
+		if ctx.Err() != context.DeadlineExceeded || !call.Deadline.IsZero() && !time.Now().Before(call.Deadline) {
+			// 客户端已经断开 取消了请求或者已经超时 不需要再回复
+			return
+		}
+		if stream != nil {
+			stream.close()
+		}
+		request.header.Metadata = request.trailer.MD()
+		s.sendError(c, request.header, status.Errorf(status.DeadlineExceeded, "rpc server: request handle timeout: expect within %s", timeout), sending)
 	}
+}
 
+// sendError 在调用方法之前回复错误 清空标记后客户端会直接结束对应的调用或者流
+func (s *Server) sendError(c codec.Codec, h *codec.Header, err error, sending *sync.Mutex) {
+	h.Flags = 0
+	status.Convert(err).Write(h)
+	s.sendResponse(c, h, invalidRequest, sending)
 }
 
 func (s *Server) sendResponse(c codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
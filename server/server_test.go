@@ -0,0 +1,329 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 16:30
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"rpc/auth"
+	"rpc/client"
+	"rpc/codec"
+	"rpc/health"
+	"rpc/metadata"
+	"rpc/option"
+	"rpc/status"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (f Foo) Panic(args Args, reply *int) error {
+	var m map[int]int
+	m[args.Num1] = args.Num2
+	return nil
+}
+
+func (f Foo) Sleep(args Args, reply *int) error {
+	time.Sleep(time.Duration(args.Num1) * time.Millisecond)
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Check Num1为负数时返回带错误码的错误
+func (f Foo) Check(args Args, reply *int) error {
+	if args.Num1 < 0 {
+		return status.Errorf(status.InvalidArgument, "num1 must not be negative")
+	}
+	*reply = args.Num1
+	return nil
+}
+
+// Trace 返回客户端发来的trace-id 并在trailer中带上处理的服务名
+func (f Foo) Trace(ctx context.Context, args Args, reply *string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	*reply = md.Get("trace-id")
+	return metadata.SetTrailer(ctx, metadata.Pairs("handled-by", "foo"))
+}
+
+type Bar int
+
+func (b Bar) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+// startServer 启动一个服务端 返回客户端
+func startServer(t *testing.T, s *Server) *client.Client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen tcp")
+	}
+	go s.Accept(l)
+	cli, err := client.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to dial server")
+	}
+	return cli
+}
+
+func TestInterceptor(t *testing.T) {
+	var foo Foo
+	var bar Bar
+	s := NewServer()
+	s.RegisterService(&foo)
+	s.RegisterService(&bar)
+	var mu sync.Mutex
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, info *RequestInfo, next Handler) error {
+			mu.Lock()
+			trace = append(trace, name+":"+info.ServiceMethod)
+			mu.Unlock()
+			return next(ctx, info)
+		}
+	}
+	s.Use(record("first"), record("second"))
+	s.UseService("Foo", func(ctx context.Context, info *RequestInfo, next Handler) error {
+		// 拦截器可以替换参数
+		info.Args = &Args{Num1: info.Args.(*Args).Num1, Num2: 100}
+		return next(ctx, info)
+	})
+	s.UseService("Bar", func(ctx context.Context, info *RequestInfo, next Handler) error {
+		return errors.New("denied")
+	})
+	cli := startServer(t, s)
+	defer func() { _ = cli.Close() }()
+
+	var reply int
+	err := cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 101, "service interceptor should change args: %v %d", err, reply)
+	err = cli.Call(context.Background(), "Bar.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && err.Error() == "denied", "service interceptor should reject the call: %v", err)
+	mu.Lock()
+	defer mu.Unlock()
+	expect := []string{"first:Foo.Sum", "second:Foo.Sum", "first:Bar.Sum", "second:Bar.Sum"}
+	_assert(fmt.Sprint(trace) == fmt.Sprint(expect), "wrong interceptor order %v", trace)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	s.RegisterService(&foo)
+	cli := startServer(t, s)
+	defer func() { _ = cli.Close() }()
+	var reply int
+	err := cli.Call(context.Background(), "Foo.Panic", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "panic"), "expect a panic error, got %v", err)
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "server should keep serving after a panic: %v", err)
+}
+
+func TestShutdown(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	s.RegisterService(&foo)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp")
+	accepted := make(chan struct{})
+	go func() {
+		s.Accept(l)
+		close(accepted)
+	}()
+	cli, err := client.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "failed to dial server: %v", err)
+	defer func() { _ = cli.Close() }()
+
+	var reply int
+	done := make(chan *client.Call, 1)
+	cli.Go("Foo.Sleep", &Args{Num1: 100, Num2: 1}, &reply, done)
+	time.Sleep(20 * time.Millisecond)
+	err = s.Shutdown(context.Background())
+	_assert(err == nil, "failed to shutdown: %v", err)
+	call := <-done
+	_assert(call.Err == nil && reply == 101, "in-flight call should finish: %v", call.Err)
+	_assert(cli.Draining(), "client should be notified of draining")
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		_assert(false, "Accept should return after shutdown")
+	}
+	_, err = client.Dial("tcp", l.Addr().String())
+	_assert(err != nil, "new connections should be refused")
+
+	// 被取消但处理函数还没有返回的请求仍然算作正在处理 空闲的连接关闭后不再登记请求
+	calls := newCallSet()
+	_, ok := calls.add(context.Background(), &codec.Header{Seq: 1}, "", 0)
+	calls.cancel(1)
+	_assert(ok && !calls.closeIfIdle(), "canceled call should keep the conn busy")
+	calls.remove(1)
+	_assert(calls.closeIfIdle(), "conn should be idle")
+	_, ok = calls.add(context.Background(), &codec.Header{Seq: 2}, "", 0)
+	_assert(!ok, "closed conn should not accept calls")
+}
+
+// TestShutdownTimedOut 超时回复之后处理函数还在运行 关闭时也要等它返回
+func TestShutdownTimedOut(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	s.RegisterService(&foo)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp")
+	go s.Accept(l)
+	cli, err := client.Dial("tcp", l.Addr().String(), &option.Option{HandleTimeOut: 20 * time.Millisecond})
+	_assert(err == nil, "failed to dial server: %v", err)
+	defer func() { _ = cli.Close() }()
+
+	var reply int
+	start := time.Now()
+	err = cli.Call(context.Background(), "Foo.Sleep", &Args{Num1: 150}, &reply)
+	_assert(status.CodeOf(err) == status.DeadlineExceeded, "expect a handle timeout, got %v", err)
+	err = s.Shutdown(context.Background())
+	_assert(err == nil && time.Since(start) >= 150*time.Millisecond, "shutdown should wait for the running handler: %v", err)
+}
+
+func TestAuth(t *testing.T) {
+	var foo Foo
+	var bar Bar
+	s := NewServer()
+	s.RegisterService(&foo)
+	s.RegisterService(&bar)
+	s.Auth = auth.StaticTokens(map[string]string{"t-alice": "alice", "t-bob": "bob"})
+	s.ACL = auth.NewACL().Allow("alice", "Foo.*", "Bar.*").Allow("bob", "Bar.*")
+	principals := make(chan string, 1)
+	s.Use(func(ctx context.Context, info *RequestInfo, next Handler) error {
+		call, _ := CallInfoFromContext(ctx)
+		principals <- call.Principal
+		return next(ctx, info)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp: %v", err)
+	go s.Accept(l)
+	defer func() { _ = s.Close() }()
+	addr := l.Addr().String()
+	var reply int
+
+	// 没有凭证的连接可以建立 但是请求会被拒绝
+	cli, err := client.Dial("tcp", addr)
+	_assert(err == nil, "failed to dial: %v", err)
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(errors.Is(err, auth.ErrUnauthenticated), "expect unauthenticated, got %v", err)
+	// 不存在的方法也先鉴权 不能据此探测方法是否存在
+	err = cli.Call(context.Background(), "Nope.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(status.CodeOf(err) == status.Unauthenticated, "expect unauthenticated for unknown method, got %v", err)
+	// 单次请求带上token
+	err = cli.Call(auth.WithToken(context.Background(), "t-alice"), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3 && <-principals == "alice", "per call token rejected: %v", err)
+	_ = cli.Close()
+
+	// 握手时带上token
+	_, err = client.Dial("tcp", addr, &option.Option{Token: "bad"})
+	_assert(err != nil, "expect handshake rejected with bad token")
+	cli, err = client.Dial("tcp", addr, &option.Option{Token: "t-bob"})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = cli.Close() }()
+	err = cli.Call(context.Background(), "Bar.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && <-principals == "bob", "bob should call Bar.Sum: %v", err)
+	err = cli.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(errors.Is(err, auth.ErrPermissionDenied) && auth.ReasonOf(err) != "", "expect permission denied, got %v", err)
+	err = cli.Call(context.Background(), "Foo.Nope", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(status.CodeOf(err) == status.PermissionDenied, "expect permission denied for unknown method, got %v", err)
+	// 健康检查不受ACL限制
+	var resp health.CheckResponse
+	err = cli.Call(context.Background(), health.CheckMethod, &health.CheckRequest{Service: "Foo"}, &resp)
+	_assert(err == nil && resp.Status == health.Serving && <-principals == "bob", "health check rejected: %v", err)
+}
+
+func TestStatus(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	s.RegisterService(&foo)
+	cli := startServer(t, s)
+	defer func() { _ = cli.Close() }()
+	var reply int
+
+	err := cli.Call(context.Background(), "Foo.Check", &Args{Num1: -1}, &reply)
+	var st *status.Status
+	_assert(errors.As(err, &st) && st.Code == status.InvalidArgument, "expect InvalidArgument, got %v", err)
+	_assert(err.Error() == "num1 must not be negative", "wrong message %q", err)
+	err = cli.Call(context.Background(), "Foo.Missing", &Args{}, &reply)
+	_assert(status.CodeOf(err) == status.NotFound, "expect NotFound, got %v", err)
+	err = cli.Call(context.Background(), "Foo.Panic", &Args{Num1: 1}, &reply)
+	_assert(status.CodeOf(err) == status.Internal, "expect Internal, got %v", err)
+}
+
+func TestMetadata(t *testing.T) {
+	var foo Foo
+	s := NewServer()
+	s.RegisterService(&foo)
+	tenants := make(chan string, 1)
+	s.Use(func(ctx context.Context, info *RequestInfo, next Handler) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tenants <- md.Get("tenant")
+		return next(ctx, info)
+	})
+	cli := startServer(t, s)
+	defer func() { _ = cli.Close() }()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("Trace-Id", "t-1"))
+	ctx = metadata.AppendToOutgoingContext(ctx, "tenant", "acme")
+	var trailer metadata.MD
+	var reply string
+	err := cli.Call(metadata.ReceiveTrailer(ctx, &trailer), "Foo.Trace", &Args{}, &reply)
+	_assert(err == nil && reply == "t-1", "handler should read metadata: %v %q", err, reply)
+	_assert(<-tenants == "acme", "interceptor should read metadata")
+	_assert(trailer.Get("handled-by") == "foo", "client should receive trailer %v", trailer)
+
+	// 没有metadata的调用不会收到上一次的trailer
+	err = cli.Call(metadata.ReceiveTrailer(context.Background(), &trailer), "Foo.Sum", &Args{Num1: 1}, new(int))
+	<-tenants
+	_assert(err == nil && len(trailer) == 0, "unexpected trailer %v", trailer)
+}
+
+// Health 用户自己的服务 名字和内置的健康检查服务相同
+type Health int
+
+func (h Health) Check(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestHealthService(t *testing.T) {
+	var h Health
+	s := NewServer()
+	s.RegisterService(&h)
+	cli := startServer(t, s)
+	defer func() { _ = cli.Close() }()
+
+	// 内置服务使用保留的名字 不影响用户的Health服务
+	var reply int
+	err := cli.Call(context.Background(), "Health.Check", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "user Health service should be callable: %v", err)
+	var resp health.CheckResponse
+	err = cli.Call(context.Background(), health.CheckMethod, &health.CheckRequest{Service: "Health"}, &resp)
+	_assert(err == nil && resp.Status == health.Serving, "registered service should be serving: %v %v", err, resp.Status)
+	err = cli.Call(context.Background(), health.CheckMethod, &health.CheckRequest{Service: "Nope"}, &resp)
+	_assert(err == nil && resp.Status == health.ServiceUnknown, "unknown service: %v %v", err, resp.Status)
+}
@@ -0,0 +1,166 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 17:30
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package server
+
+import (
+	"context"
+	"net"
+	"rpc/codec"
+	"rpc/logger"
+	"rpc/registry"
+	"rpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shutdownPollInterval 关闭时检查连接是否空闲的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
+// ErrServerClosed 服务端关闭之后收到的请求返回这个错误
+var ErrServerClosed error = status.New(status.Unavailable, "rpc server: server is shutting down")
+
+// serverConn 服务端的一个连接
+type serverConn struct {
+	c       codec.Codec
+	sending *sync.Mutex
+	calls   *callSet
+	drain   bool                     // 客户端是否能够识别drain通知
+	mu      sync.Mutex               // 保护streams
+	streams map[uint64]*serverStream // 正在进行的流
+}
+
+// notifyDrain 通知客户端服务端正在关闭 不要再发送新的请求
+func (sc *serverConn) notifyDrain() {
+	if !sc.drain {
+		return
+	}
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	if err := sc.c.Write(&codec.Header{Flags: codec.FlagDrain}, invalidRequest); err != nil {
+		logger.Logger.Println("rpc server: send drain fail,err:", err)
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
+// trackListener 记录正在使用的监听器 关闭之后不能再添加
+func (s *Server) trackListener(lis net.Listener, add bool) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if !add {
+		delete(s.listeners, lis)
+		return true
+	}
+	if s.shuttingDown() {
+		return false
+	}
+	s.listeners[lis] = struct{}{}
+	return true
+}
+
+// trackConn 记录正在服务的连接 关闭之后不能再添加
+func (s *Server) trackConn(sc *serverConn, add bool) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if !add {
+		delete(s.conns, sc)
+		return true
+	}
+	if s.shuttingDown() {
+		return false
+	}
+	s.conns[sc] = struct{}{}
+	return true
+}
+
+// RegisterOnShutdown 注册关闭时执行的函数
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// HeartBeat 向注册中心发送心跳 服务端关闭时停止心跳并从注册中心注销
+func (s *Server) HeartBeat(registryAddr, addr string, duration time.Duration) {
+	stop := registry.HeartBeat(registryAddr, addr, duration)
+	s.RegisterOnShutdown(func() {
+		stop()
+		_ = registry.Unregister(registryAddr, addr)
+	})
+}
+
+// beginShutdown 停止接收新连接 返回当前所有的连接
+func (s *Server) beginShutdown() []*serverConn {
+	s.connMu.Lock()
+	atomic.StoreInt32(&s.inShutdown, 1)
+	for lis := range s.listeners {
+		_ = lis.Close()
+		delete(s.listeners, lis)
+	}
+	onShutdown := s.onShutdown
+	s.onShutdown = nil
+	conns := make([]*serverConn, 0, len(s.conns))
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.connMu.Unlock()
+	s.Health.Shutdown()
+	for _, f := range onShutdown {
+		f()
+	}
+	return conns
+}
+
+// Shutdown 优雅关闭 停止接收新连接 通知客户端 等待正在处理的请求完成后关闭连接
+// ctx超时的话直接关闭所有连接并返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	for _, sc := range s.beginShutdown() {
+		sc.notifyDrain()
+	}
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close 立即关闭所有的监听器和连接
+func (s *Server) Close() error {
+	s.beginShutdown()
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	for sc := range s.conns {
+		_ = sc.c.Close()
+		delete(s.conns, sc)
+	}
+	return nil
+}
+
+// closeIdleConns 关闭没有请求在处理的连接 全部关闭后返回true
+func (s *Server) closeIdleConns() bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	for sc := range s.conns {
+		if sc.calls.closeIfIdle() {
+			_ = sc.c.Close()
+			delete(s.conns, sc)
+		}
+	}
+	return len(s.conns) == 0
+}
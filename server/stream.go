@@ -0,0 +1,175 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 18:30
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"rpc/codec"
+	"rpc/flow"
+	"rpc/logger"
+	"rpc/service"
+	"sync"
+)
+
+// Stream 流式方法中使用的流 方法形式为 M(args, stream server.Stream) error
+type Stream = service.Stream
+
+// ErrStreamClosed 流式方法返回之后再收发消息
+var ErrStreamClosed = errors.New("rpc server: stream is closed")
+
+// serverStream 服务端的流 发给客户端的消息都使用打开流的请求的Seq
+type serverStream struct {
+	ctx     context.Context
+	c       codec.Codec
+	sending *sync.Mutex
+	header  codec.Header // 发送消息时使用的header
+	typ     reflect.Type // 客户端消息的类型
+	queue   *flow.Queue  // 客户端发来的消息
+	credit  *flow.Credit // 发送额度
+	mu      sync.Mutex
+	closed  bool
+}
+
+func newServerStream(ctx context.Context, c codec.Codec, h *codec.Header, sending *sync.Mutex, typ reflect.Type) *serverStream {
+	return &serverStream{
+		ctx:     ctx,
+		c:       c,
+		sending: sending,
+		header:  codec.Header{ServiceMethod: h.ServiceMethod, Seq: h.Seq, StreamID: h.Seq, Flags: codec.FlagStreamData},
+		typ:     typ,
+		queue:   flow.NewQueue(),
+		credit:  flow.NewCredit(),
+	}
+}
+
+func (st *serverStream) Context() context.Context {
+	return st.ctx
+}
+
+func (st *serverStream) Send(reply interface{}) error {
+	// 等待客户端归还窗口 不能持有锁
+	if err := st.credit.Acquire(st.ctx); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return ErrStreamClosed
+	}
+	if err := st.ctx.Err(); err != nil {
+		return err
+	}
+	st.sending.Lock()
+	defer st.sending.Unlock()
+	h := st.header
+	return st.c.Write(&h, reply)
+}
+
+func (st *serverStream) Recv(args interface{}) error {
+	v, update, err := st.queue.Pop(st.ctx)
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(args).Elem().Set(v.Elem())
+	if update > 0 {
+		st.sending.Lock()
+		defer st.sending.Unlock()
+		h := codec.Header{Seq: st.header.Seq, StreamID: st.header.StreamID, Flags: codec.FlagWindowUpdate, Window: uint32(update)}
+		if err = st.c.Write(&h, invalidRequest); err != nil {
+			logger.Logger.Println("rpc server: send window update fail,err:", err)
+		}
+	}
+	return nil
+}
+
+// close 方法返回后关闭流 之后的收发都会失败
+func (st *serverStream) close() {
+	st.mu.Lock()
+	st.closed = true
+	st.mu.Unlock()
+	st.credit.Close(ErrStreamClosed)
+	st.queue.Finish(ErrStreamClosed)
+}
+
+// isStreamMessage 判断是否是流中的后续消息 打开流的请求Seq和StreamID相同
+func isStreamMessage(h *codec.Header) bool {
+	return h.Flags&(codec.FlagStreamData|codec.FlagHalfClose) != 0 && h.Seq != h.StreamID
+}
+
+// openStream 打开一个流 需要在读取下一条消息之前完成 否则客户端紧接着发来的消息会找不到流
+func (sc *serverConn) openStream(ctx context.Context, request *Request) *serverStream {
+	typ := request.args.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	st := newServerStream(ctx, sc.c, request.header, sc.sending, typ)
+	if request.header.Flags&codec.FlagHalfClose != 0 {
+		// 客户端只发送了打开流的消息
+		st.queue.Finish(io.EOF)
+	}
+	sc.mu.Lock()
+	sc.streams[request.header.Seq] = st
+	sc.mu.Unlock()
+	return st
+}
+
+func (sc *serverConn) getStream(id uint64) *serverStream {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.streams[id]
+}
+
+func (sc *serverConn) removeStream(id uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.streams, id)
+}
+
+// receiveStream 把客户端发来的流消息放入对应流的队列 只有连接出错时才返回错误
+func (sc *serverConn) receiveStream(h *codec.Header) error {
+	st := sc.getStream(h.StreamID)
+	if st == nil {
+		// 流已经结束了
+		return sc.c.ReadBody(nil)
+	}
+	if h.Flags&codec.FlagStreamData == 0 {
+		if err := sc.c.ReadBody(nil); err != nil {
+			return err
+		}
+	} else {
+		v := reflect.New(st.typ)
+		if err := sc.c.ReadBody(v.Interface()); err != nil {
+			if !codec.IsBodyError(err) {
+				return err
+			}
+			st.queue.Finish(err)
+			return nil
+		}
+		if err := st.queue.Push(v); err != nil {
+			// 客户端没有遵守流控 结束这个流
+			logger.Logger.Println("rpc server: stream", h.StreamID, err)
+			st.queue.Finish(err)
+			sc.calls.cancel(h.StreamID)
+			return nil
+		}
+	}
+	if h.Flags&codec.FlagHalfClose != 0 {
+		st.queue.Finish(io.EOF)
+	}
+	return nil
+}
+
+// addCredit 收到客户端的窗口更新
+func (sc *serverConn) addCredit(h *codec.Header) {
+	if st := sc.getStream(h.StreamID); st != nil {
+		st.credit.Add(int(h.Window))
+	}
+}
@@ -8,6 +8,7 @@
 package service
 
 import (
+	"context"
 	"go/ast"
 	"reflect"
 	"rpc/logger"
@@ -26,8 +27,16 @@ type Method struct {
 	Args    reflect.Type   // 方法传入的参数
 	Reply   reflect.Type   // 函数的返回值
 	CallNum uint64         // 这个函数被调用的次数
+	Context bool           // 第一个参数是否是context.Context
+	Stream  bool           // 是否是流式方法 此时Reply是Stream类型
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfStream  = reflect.TypeOf((*Stream)(nil)).Elem()
+)
+
 func (m *Method) CallNums() uint64 {
 	return atomic.LoadUint64(&m.CallNum) // 原子操作读取某数字
 }
@@ -71,15 +80,26 @@ func (s *Service) registerMethod() {
 		var m Method
 		method := s.Type.Method(i)     // 第i个方法名字
 		mType := s.Type.Method(i).Type // 第i个方法的类型
-		if mType.NumOut() != 1 || mType.NumIn() != 3 {
+		// 支持两种形式 M(args, reply) error 和 M(ctx, args, reply) error
+		if mType.NumOut() != 1 || (mType.NumIn() != 3 && mType.NumIn() != 4) {
 			logger.Logger.Println("ERRO:", "num of parameters is wrong")
 			continue
 		}
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		if mType.Out(0) != typeOfError {
 			logger.Logger.Println("ERRO:", "the type of first out is not error")
 			continue
 		}
-		m.Args, m.Reply, m.Method = mType.In(1), mType.In(2), method // 分别赋值第一个 第二个参数的Type
+		first := 1
+		if mType.NumIn() == 4 {
+			if mType.In(1) != typeOfContext {
+				logger.Logger.Println("ERRO:", "the type of first in is not context.Context")
+				continue
+			}
+			m.Context = true
+			first = 2
+		}
+		m.Args, m.Reply, m.Method = mType.In(first), mType.In(first+1), method // 分别赋值第一个 第二个参数的Type
+		m.Stream = m.Reply == typeOfStream
 		// 如果这两个参数 有不是被引入的或者是内嵌的类型 那么直接返回
 		if !isExportedOrBuiltinType(m.Args) || !isExportedOrBuiltinType(m.Reply) {
 			continue
@@ -97,10 +117,19 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 
 // Call 调用需要传入 函数名字 参数 返回值  error
 func (s *Service) Call(name string, args reflect.Value, reply reflect.Value) error {
+	return s.CallContext(context.Background(), name, args, reply)
+}
+
+// CallContext 带上下文的调用 如果方法的第一个参数是context.Context 会把ctx传进去
+func (s *Service) CallContext(ctx context.Context, name string, args reflect.Value, reply reflect.Value) error {
 	m := s.Methods[name] //取出函数对应的Method
 	atomic.AddUint64(&m.CallNum, 1)
 	f := m.Method.Func
-	out := f.Call([]reflect.Value{s.Value, args, reply})
+	in := []reflect.Value{s.Value, args, reply}
+	if m.Context {
+		in = []reflect.Value{s.Value, reflect.ValueOf(ctx), args, reply}
+	}
+	out := f.Call(in)
 	// 如果有错误的话转义 否则直接返回nil
 	if errInter := out[0].Interface(); errInter != nil {
 		return errInter.(error)
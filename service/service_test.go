@@ -8,6 +8,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -53,3 +54,26 @@ func TestMethodType_Call(t *testing.T) {
 	err := s.Call(m.Method.Name, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && m.CallNums() == 1, "failed to call Foo.Sum")
 }
+
+type Bar int
+
+type ctxKey struct{}
+
+func (b Bar) Sum(ctx context.Context, args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2 + ctx.Value(ctxKey{}).(int)
+	return nil
+}
+
+func TestContextMethod(t *testing.T) {
+	var bar Bar
+	s := NewService(&bar)
+	m := s.Methods["Sum"]
+	_assert(m != nil && m.Context, "wrong Method, Sum should accept context")
+
+	argv := m.NewArgs()
+	replyv := m.NewReply()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
+	ctx := context.WithValue(context.Background(), ctxKey{}, 10)
+	err := s.CallContext(ctx, m.Method.Name, argv, replyv)
+	_assert(err == nil && *replyv.Interface().(*int) == 14, "failed to call Bar.Sum with context")
+}
@@ -0,0 +1,20 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 18:10
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package service
+
+import "context"
+
+// Stream 流式方法用来和客户端连续收发消息
+// 流式方法的形式为 M(args, stream Stream) error 或者 M(ctx, args, stream Stream) error
+// args是客户端发送的第一条消息 之后的消息通过Recv读取 类型和args相同
+// 方法返回之后流结束 返回的错误会带给客户端
+type Stream interface {
+	Context() context.Context     // 调用的上下文 客户端取消或者断开时会被取消
+	Send(reply interface{}) error // 发送一条回复
+	Recv(args interface{}) error  // 读取客户端的下一条消息 客户端关闭发送后返回io.EOF
+}
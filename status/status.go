@@ -0,0 +1,204 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 21:40
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"rpc/codec"
+	"strconv"
+)
+
+// Code 错误码 和gRPC的错误码保持一致 方便其他语言的客户端对照
+type Code uint32
+
+const (
+	OK                 Code = iota // 没有错误
+	Canceled                       // 调用被取消
+	Unknown                        // 未知错误 没有错误码的错误都当作这一类
+	InvalidArgument                // 参数错误
+	DeadlineExceeded               // 超时
+	NotFound                       // 服务或者方法不存在
+	AlreadyExists                  // 资源已经存在
+	PermissionDenied               // 没有权限
+	ResourceExhausted              // 资源耗尽 例如服务端过载或者消息太大
+	FailedPrecondition             // 前置条件不满足
+	Aborted                        // 操作被中止 一般可以重试
+	OutOfRange                     // 超出范围
+	Unimplemented                  // 服务端没有实现
+	Internal                       // 服务端内部错误
+	Unavailable                    // 服务暂时不可用 可以换一个服务端重试
+	DataLoss                       // 数据丢失
+	Unauthenticated                // 没有通过认证
+)
+
+var codeNames = []string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound", "AlreadyExists",
+	"PermissionDenied", "ResourceExhausted", "FailedPrecondition", "Aborted", "OutOfRange",
+	"Unimplemented", "Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "Code(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Detail 错误的附加信息 Value是json编码后的值
+type Detail struct {
+	Type  string
+	Value json.RawMessage
+}
+
+// Status 带错误码的错误 服务方法可以直接返回 客户端可以用errors.As取出
+type Status struct {
+	Code    Code
+	Message string
+	Details []Detail
+}
+
+func New(code Code, msg string) *Status {
+	return &Status{Code: code, Message: msg}
+}
+
+// Errorf 创建一个带错误码的错误
+func Errorf(code Code, format string, a ...interface{}) error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+// Error 只返回错误信息 和没有错误码时Header.Err中的内容一致
+func (s *Status) Error() string {
+	return s.Message
+}
+
+// Is 错误码和错误信息都相同才认为是同一个错误 这样从对端收到的错误也能匹配预先定义的错误
+// 只比较错误码时使用CodeOf
+func (s *Status) Is(target error) bool {
+	t, ok := target.(*Status)
+	return ok && t.Code == s.Code && t.Message == s.Message
+}
+
+// WithDetails 返回附带了details的新状态 details需要能被json编码
+func (s *Status) WithDetails(details ...interface{}) (*Status, error) {
+	st := *s
+	st.Details = append([]Detail(nil), s.Details...)
+	for _, d := range details {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		st.Details = append(st.Details, Detail{Type: typeName(d), Value: data})
+	}
+	return &st, nil
+}
+
+// Detail 把第一个类型和v相同的详情解码到v中 v必须是指针 没有找到时返回false
+func (s *Status) Detail(v interface{}) bool {
+	name := typeName(v)
+	for _, d := range s.Details {
+		if d.Type == name {
+			return json.Unmarshal(d.Value, v) == nil
+		}
+	}
+	return false
+}
+
+func typeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// FromError 取出错误中的状态 ok为false说明错误没有错误码 返回的状态根据错误的类型推断
+func FromError(err error) (st *Status, ok bool) {
+	if err == nil {
+		return New(OK, ""), true
+	}
+	var s *Status
+	if errors.As(err, &s) {
+		if s == err {
+			return s, true
+		}
+		// 被包装过的状态 保留完整的错误信息
+		c := *s
+		c.Message = err.Error()
+		return &c, true
+	}
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(DeadlineExceeded, err.Error()), false
+	case errors.Is(err, context.Canceled):
+		return New(Canceled, err.Error()), false
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &ne):
+		// 连接断开
+		return New(Unavailable, err.Error()), false
+	}
+	return New(Unknown, err.Error()), false
+}
+
+// Convert 把任意错误转换成状态
+func Convert(err error) *Status {
+	st, _ := FromError(err)
+	return st
+}
+
+// CodeOf 错误的错误码 nil返回OK
+func CodeOf(err error) Code {
+	return Convert(err).Code
+}
+
+// IsRetryable 判断错误是否可以换一个服务端重试 这些错误说明请求没有被处理或者处理被中止
+func IsRetryable(err error) bool {
+	switch CodeOf(err) {
+	case Unavailable, ResourceExhausted, Aborted:
+		return true
+	}
+	return false
+}
+
+// Write 把状态写入header Err中仍然是错误信息 旧版本的对端可以照常读取
+// 错误信息为空时写入错误码的名字 否则旧版本的对端会当成调用成功
+func (s *Status) Write(h *codec.Header) {
+	h.Err = s.Message
+	if h.Err == "" && s.Code != OK {
+		h.Err = s.Code.String()
+	}
+	h.Code = uint32(s.Code)
+	h.Details = nil
+	if len(s.Details) > 0 {
+		h.Details, _ = json.Marshal(s.Details)
+	}
+}
+
+// FromHeader 读取header中的状态 没有错误时返回nil
+// 旧版本的对端只会写Err 这时错误码是Unknown
+func FromHeader(h *codec.Header) *Status {
+	if h.Err == "" && h.Code == uint32(OK) {
+		return nil
+	}
+	st := New(Code(h.Code), h.Err)
+	if st.Code == OK {
+		st.Code = Unknown
+	}
+	if len(h.Details) > 0 {
+		_ = json.Unmarshal(h.Details, &st.Details)
+	}
+	return st
+}
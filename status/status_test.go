@@ -0,0 +1,61 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 22:00
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rpc/codec"
+	"testing"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+type RetryInfo struct {
+	DelayMs int
+}
+
+func TestHeader(t *testing.T) {
+	st, err := New(ResourceExhausted, "overloaded").WithDetails(&RetryInfo{DelayMs: 100})
+	_assert(err == nil, "failed to add details: %v", err)
+	var h codec.Header
+	st.Write(&h)
+	_assert(h.Err == "overloaded", "Err should keep the message for old peers")
+
+	got := FromHeader(&h)
+	var info RetryInfo
+	_assert(got.Code == ResourceExhausted && got.Detail(&info) && info.DelayMs == 100, "wrong status %+v", got)
+	_assert(IsRetryable(got), "ResourceExhausted should be retryable")
+
+	// 旧版本的对端只有错误信息
+	got = FromHeader(&codec.Header{Err: "boom"})
+	_assert(got.Code == Unknown && got.Message == "boom", "wrong legacy status %+v", got)
+	_assert(FromHeader(&codec.Header{}) == nil, "no error should have no status")
+
+	// 没有错误信息的状态也不能被旧版本的对端当成成功
+	h = codec.Header{}
+	New(Internal, "").Write(&h)
+	_assert(h.Err == Internal.String(), "empty message should fall back to the code name, got %q", h.Err)
+}
+
+func TestFromError(t *testing.T) {
+	err := fmt.Errorf("load user: %w", Errorf(NotFound, "user %d", 1))
+	_assert(errors.Is(err, New(NotFound, "user 1")), "errors.Is should match code and message")
+	_assert(!errors.Is(err, New(NotFound, "user 2")) && CodeOf(err) == NotFound, "errors.Is should not match by code alone")
+	var st *Status
+	_assert(errors.As(err, &st) && st.Message == "user 1", "errors.As should find the status")
+	_assert(Convert(err).Message == "load user: user 1", "wrapped status should keep the full message")
+
+	_assert(CodeOf(fmt.Errorf("call: %w", context.DeadlineExceeded)) == DeadlineExceeded, "expect DeadlineExceeded")
+	_assert(CodeOf(errors.New("boom")) == Unknown && CodeOf(nil) == OK, "wrong default codes")
+}
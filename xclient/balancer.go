@@ -0,0 +1,183 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 09:30
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"rpc/status"
+	"sync"
+	"time"
+)
+
+// PickInfo 选择地址时可以参考的调用信息
+type PickInfo struct {
+	Ctx           context.Context
+	ServiceMethod string
+	Args          interface{}
+}
+
+// Balancer 负载均衡策略 从可用的地址中选出一个
+// servers已经去掉了不可用的地址 stats是XClient收集的每个地址的统计
+type Balancer interface {
+	Pick(info *PickInfo, servers []string, stats *Stats) (string, error)
+}
+
+// retainer 为每个地址保存状态的负载均衡策略 服务列表变化时删除已经下线的地址
+type retainer interface {
+	retain(addrs []string)
+}
+
+// ErrNoServers 没有可用的地址
+var ErrNoServers error = status.New(status.Unavailable, "rpc xclient: no available servers")
+
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	weights map[string]int
+	current map[string]int
+}
+
+// NewWeightedRoundRobin 平滑加权轮询 没有配置权重的地址权重为1
+func NewWeightedRoundRobin(weights map[string]int) Balancer {
+	return &weightedRoundRobin{weights: weights, current: make(map[string]int)}
+}
+
+func (b *weightedRoundRobin) weight(addr string) int {
+	if w, ok := b.weights[addr]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Pick 每次所有地址加上自己的权重 选出当前值最大的地址 再减去总权重
+func (b *weightedRoundRobin) Pick(_ *PickInfo, servers []string, _ *Stats) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoServers
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	total, best := 0, ""
+	for _, addr := range servers {
+		w := b.weight(addr)
+		total += w
+		b.current[addr] += w
+		if best == "" || b.current[addr] > b.current[best] {
+			best = addr
+		}
+	}
+	b.current[best] -= total
+	return best, nil
+}
+
+// retain 删除已经不在服务列表中的地址的当前值
+func (b *weightedRoundRobin) retain(addrs []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.current) <= len(addrs) {
+		return
+	}
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	for addr := range b.current {
+		if !keep[addr] {
+			delete(b.current, addr)
+		}
+	}
+}
+
+type leastOutstanding struct{}
+
+// NewLeastOutstanding 选择正在进行的调用最少的地址 相同时随机选择
+func NewLeastOutstanding() Balancer {
+	return leastOutstanding{}
+}
+
+func (leastOutstanding) Pick(_ *PickInfo, servers []string, stats *Stats) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoServers
+	}
+	offset := rand.Intn(len(servers))
+	best, min := "", 0
+	for i := range servers {
+		addr := servers[(i+offset)%len(servers)]
+		if n := stats.Get(addr).Outstanding(); best == "" || n < min {
+			best, min = addr, n
+		}
+	}
+	return best, nil
+}
+
+type powerOfTwoChoices struct{}
+
+// NewPowerOfTwoChoices 随机选出两个地址 使用正在进行的调用较少的一个
+func NewPowerOfTwoChoices() Balancer {
+	return powerOfTwoChoices{}
+}
+
+func (powerOfTwoChoices) Pick(_ *PickInfo, servers []string, stats *Stats) (string, error) {
+	switch len(servers) {
+	case 0:
+		return "", ErrNoServers
+	case 1:
+		return servers[0], nil
+	}
+	i := rand.Intn(len(servers))
+	j := rand.Intn(len(servers) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := servers[i], servers[j]
+	if stats.Get(b).Outstanding() < stats.Get(a).Outstanding() {
+		return b, nil
+	}
+	return a, nil
+}
+
+type latencyEWMA struct{}
+
+// NewLatencyEWMA 选择平均延迟乘以(正在进行的调用数+1)最小的地址
+// 没有延迟样本的地址按其他地址的平均延迟计算 既不会被当成最快 也不会一直选不到
+func NewLatencyEWMA() Balancer {
+	return latencyEWMA{}
+}
+
+func (latencyEWMA) Pick(_ *PickInfo, servers []string, stats *Stats) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoServers
+	}
+	latencies := make([]time.Duration, len(servers))
+	var sum time.Duration
+	known := 0
+	for i, addr := range servers {
+		if latencies[i] = stats.Get(addr).Latency(); latencies[i] > 0 {
+			sum += latencies[i]
+			known++
+		}
+	}
+	unknown := time.Duration(1)
+	if known > 0 {
+		unknown = sum / time.Duration(known)
+	}
+	offset := rand.Intn(len(servers))
+	best, min := "", time.Duration(0)
+	for i := range servers {
+		j := (i + offset) % len(servers)
+		latency := latencies[j]
+		if latency == 0 {
+			latency = unknown
+		}
+		cost := latency * time.Duration(stats.Get(servers[j]).Outstanding()+1)
+		// 代价相同时优先没有样本的地址 让新地址尽快得到样本
+		if best == "" || cost < min || cost == min && latencies[j] == 0 {
+			best, min = servers[j], cost
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,265 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 15:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"rpc/status"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 熔断 不再选择这个地址
+	BreakerHalfOpen                     // 冷却结束 放行少量探测调用
+)
+
+var breakerStateNames = []string{"CLOSED", "OPEN", "HALF_OPEN"}
+
+func (s BreakerState) String() string {
+	if s >= 0 && int(s) < len(breakerStateNames) {
+		return breakerStateNames[s]
+	}
+	return "INVALID_STATE"
+}
+
+// ErrBreakerOpen 地址的熔断器没有放行 可以换一个服务端重试
+var ErrBreakerOpen error = status.New(status.Unavailable, "rpc xclient: circuit breaker is open")
+
+// BreakerOption 每个地址的熔断配置 连续失败和错误率任意一个达到阈值就熔断
+type BreakerOption struct {
+	ConsecutiveFailures int              // 连续失败多少次后熔断 0表示不按连续失败判断
+	ErrorRate           float64          // 窗口内的错误率达到后熔断 0表示不按错误率判断
+	MinRequests         int              // 窗口内的调用数达到后才按错误率判断
+	Window              time.Duration    // 统计错误率的时间窗口 每个窗口重新计数
+	Cooldown            time.Duration    // 熔断后等待多久进入半开状态
+	HalfOpenProbes      int              // 半开状态同时放行的探测调用数 全部成功后恢复 为0时按1处理
+	IsFailure           func(error) bool // 判断错误是否算作失败 为空时使用serverFailure
+	// OnStateChange 状态变化时调用 在锁外执行 可以用来打日志或者上报监控
+	OnStateChange func(addr string, from, to BreakerState)
+}
+
+// DefaultBreakerOption 连续5次失败或者10秒内一半的调用失败时熔断 5秒后探测
+var DefaultBreakerOption = BreakerOption{
+	ConsecutiveFailures: 5,
+	ErrorRate:           0.5,
+	MinRequests:         20,
+	Window:              10 * time.Second,
+	Cooldown:            5 * time.Second,
+	HalfOpenProbes:      1,
+}
+
+// serverFailure 只有服务端不可用或者超时才算失败 业务错误和调用方取消不算
+func serverFailure(err error) bool {
+	return status.IsRetryable(err) || status.CodeOf(err) == status.DeadlineExceeded
+}
+
+// canceled 调用方主动放弃的调用 例如对冲和广播中落后的调用 结果不能说明服务端是否可用
+func canceled(err error) bool {
+	return err != nil && status.CodeOf(err) == status.Canceled
+}
+
+func (o *BreakerOption) enabled() bool {
+	return o.ConsecutiveFailures > 0 || o.ErrorRate > 0
+}
+
+func (o *BreakerOption) probes() int {
+	if o.HalfOpenProbes <= 0 {
+		return 1
+	}
+	return o.HalfOpenProbes
+}
+
+// breaker 一个地址的熔断器
+type breaker struct {
+	state       BreakerState
+	openedAt    time.Time
+	windowStart time.Time
+	calls       int
+	failures    int
+	consecutive int
+	probes      int // 半开状态下正在进行的探测调用
+	succeeded   int // 半开状态下成功的探测调用
+}
+
+// breakers 所有地址的熔断器 没有配置时不做任何限制
+type breakers struct {
+	mu      sync.Mutex
+	opt     BreakerOption
+	m       map[string]*breaker
+	changes []func() // 等待解锁后通知的状态变化
+}
+
+func newBreakers() *breakers {
+	return &breakers{m: make(map[string]*breaker)}
+}
+
+func (bs *breakers) setOption(opt BreakerOption) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.opt = opt
+	bs.m = make(map[string]*breaker)
+}
+
+// stateLocked 地址当前的状态 熔断超过冷却时间后视为半开
+func (bs *breakers) stateLocked(addr string, now time.Time) (*breaker, BreakerState) {
+	b, ok := bs.m[addr]
+	if !ok {
+		return nil, BreakerClosed
+	}
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= bs.opt.Cooldown {
+		return b, BreakerHalfOpen
+	}
+	return b, b.state
+}
+
+// ready 地址能否被选中 不改变状态
+func (bs *breakers) ready(addr string) bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if !bs.opt.enabled() {
+		return true
+	}
+	b, state := bs.stateLocked(addr, time.Now())
+	switch state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return b.state == BreakerOpen || b.probes < bs.opt.probes()
+	}
+	return true
+}
+
+// state 地址当前的状态
+func (bs *breakers) state(addr string) BreakerState {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	_, state := bs.stateLocked(addr, time.Now())
+	return state
+}
+
+// unlock 解锁之后再通知状态变化 回调里可以访问XClient
+func (bs *breakers) unlock() {
+	changes := bs.changes
+	bs.changes = nil
+	bs.mu.Unlock()
+	for _, notify := range changes {
+		notify()
+	}
+}
+
+// allow 调用前检查是否放行 半开状态下占用一个探测名额 probe表示这次调用是探测
+func (bs *breakers) allow(addr string) (ok, probe bool) {
+	bs.mu.Lock()
+	defer bs.unlock()
+	if !bs.opt.enabled() {
+		return true, false
+	}
+	now := time.Now()
+	b, state := bs.stateLocked(addr, now)
+	switch state {
+	case BreakerOpen:
+		return false, false
+	case BreakerHalfOpen:
+		if b.state == BreakerOpen {
+			bs.setStateLocked(addr, b, BreakerHalfOpen, now)
+		}
+		if b.probes >= bs.opt.probes() {
+			return false, false
+		}
+		b.probes++
+		return true, true
+	}
+	return true, false
+}
+
+// record 记录一次放行的调用的结果 被取消的调用不计入统计 只归还探测名额
+func (bs *breakers) record(addr string, probe bool, err error) {
+	bs.mu.Lock()
+	defer bs.unlock()
+	if canceled(err) {
+		if b, ok := bs.m[addr]; ok && probe && b.state == BreakerHalfOpen {
+			b.probes--
+		}
+		return
+	}
+	isFailure := serverFailure
+	if bs.opt.IsFailure != nil {
+		isFailure = bs.opt.IsFailure
+	}
+	bs.recordLocked(addr, probe, err != nil && isFailure(err))
+}
+
+// fail 记录一次连接失败 连不上服务端总是算作失败
+func (bs *breakers) fail(addr string, probe bool) {
+	bs.mu.Lock()
+	defer bs.unlock()
+	bs.recordLocked(addr, probe, true)
+}
+
+func (bs *breakers) recordLocked(addr string, probe, failed bool) {
+	opt := &bs.opt
+	if !opt.enabled() {
+		return
+	}
+	now := time.Now()
+	b, ok := bs.m[addr]
+	if !ok {
+		b = &breaker{windowStart: now}
+		bs.m[addr] = b
+	}
+	// 状态已经变化的话 之前发出的调用的结果不再影响状态
+	if probe {
+		if b.state != BreakerHalfOpen {
+			return
+		}
+		b.probes--
+		if failed {
+			bs.setStateLocked(addr, b, BreakerOpen, now)
+			return
+		}
+		if b.succeeded++; b.succeeded >= opt.probes() {
+			bs.setStateLocked(addr, b, BreakerClosed, now)
+		}
+		return
+	}
+	if b.state != BreakerClosed {
+		return
+	}
+	if opt.Window > 0 && now.Sub(b.windowStart) >= opt.Window {
+		b.windowStart, b.calls, b.failures = now, 0, 0
+	}
+	b.calls++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+	if opt.ConsecutiveFailures > 0 && b.consecutive >= opt.ConsecutiveFailures ||
+		opt.ErrorRate > 0 && b.calls >= opt.MinRequests && float64(b.failures) >= opt.ErrorRate*float64(b.calls) {
+		bs.setStateLocked(addr, b, BreakerOpen, now)
+	}
+}
+
+// setStateLocked 切换状态并清空计数
+func (bs *breakers) setStateLocked(addr string, b *breaker, to BreakerState, now time.Time) {
+	from := b.state
+	b.state = to
+	b.windowStart, b.calls, b.failures, b.consecutive = now, 0, 0, 0
+	b.probes, b.succeeded = 0, 0
+	if to == BreakerOpen {
+		b.openedAt = now
+	}
+	if cb := bs.opt.OnStateChange; cb != nil {
+		bs.changes = append(bs.changes, func() { cb(addr, from, to) })
+	}
+}
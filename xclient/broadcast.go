@@ -0,0 +1,160 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 15:00
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"rpc/metadata"
+	"rpc/status"
+)
+
+// Result 一个服务端的调用结果
+type Result struct {
+	Addr    string
+	Reply   interface{} // 和传入的reply类型相同的指针 出错时为零值
+	Err     error
+	Trailer metadata.MD
+}
+
+// servers 广播的目标 服务列表中的所有地址
+// 不跳过熔断的地址 这些地址的结果是ErrBreakerOpen 调用方可以看到哪些服务端没有参与
+func (xclient *XClient) servers() ([]string, error) {
+	servers, err := xclient.d.GetAll()
+	if err == nil && len(servers) == 0 {
+		err = ErrNoServers
+	}
+	return servers, err
+}
+
+// multicast 向servers并发发出请求 结果按完成的顺序放入返回的通道
+func (xclient *XClient) multicast(ctx context.Context, servers []string, serviceMethod string, args, reply interface{}) <-chan *Result {
+	results := make(chan *Result, len(servers))
+	for _, rpcAddr := range servers {
+		go func(rpcAddr string) {
+			r := &Result{Addr: rpcAddr, Reply: reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()}
+			r.Err = xclient.call(rpcAddr, metadata.ReceiveTrailer(ctx, &r.Trailer), serviceMethod, args, r.Reply)
+			results <- r
+		}(rpcAddr)
+	}
+	return results
+}
+
+// group 把回复相同的结果放在同一组 返回r所在的组
+func group(groups *[][]*Result, r *Result) []*Result {
+	for i, g := range *groups {
+		if reflect.DeepEqual(g[0].Reply, r.Reply) {
+			(*groups)[i] = append(g, r)
+			return (*groups)[i]
+		}
+	}
+	*groups = append(*groups, []*Result{r})
+	return []*Result{r}
+}
+
+// setReply 把结果写入调用方的reply和trailer
+func setReply(ctx context.Context, reply interface{}, r *Result) {
+	reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(r.Reply).Elem())
+	if target := metadata.TrailerTarget(ctx); target != nil {
+		*target = r.Trailer
+	}
+}
+
+// Fork 向所有服务端发出请求 返回第一个成功的回复并取消其他请求 全部失败时返回第一个错误
+func (xclient *XClient) Fork(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if err := checkReply(reply); err != nil {
+		return err
+	}
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	servers, err := xclient.servers()
+	if err != nil {
+		return err
+	}
+	results := xclient.multicast(callCtx, servers, serviceMethod, args, reply)
+	var first error
+	for range servers {
+		r := <-results
+		if r.Err == nil {
+			setReply(ctx, reply, r)
+			return nil
+		}
+		if first == nil {
+			first = r.Err
+		}
+	}
+	return first
+}
+
+// Quorum 向所有服务端发出请求 有n个服务端返回相同的回复时成功 并取消其他请求
+// 剩下的服务端已经不可能凑够n个相同的回复时失败
+func (xclient *XClient) Quorum(ctx context.Context, n int, serviceMethod string, args, reply interface{}) error {
+	if err := checkReply(reply); err != nil {
+		return err
+	}
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	servers, err := xclient.servers()
+	if err != nil {
+		return err
+	}
+	total := len(servers)
+	if n < 1 || n > total {
+		return status.Errorf(status.FailedPrecondition, "rpc xclient: quorum %d with %d servers", n, total)
+	}
+	results := xclient.multicast(callCtx, servers, serviceMethod, args, reply)
+	var groups [][]*Result
+	var first error
+	best := 0
+	for i := 0; i < total; i++ {
+		r := <-results
+		if r.Err != nil {
+			if first == nil {
+				first = r.Err
+			}
+		} else if g := group(&groups, r); len(g) >= n {
+			setReply(ctx, reply, r)
+			return nil
+		} else if len(g) > best {
+			best = len(g)
+		}
+		// 剩下的服务端全部和最大的一组相同也凑不够n个
+		if best+total-i-1 < n {
+			break
+		}
+	}
+	msg := fmt.Sprintf("rpc xclient: quorum of %d not reached, largest agreement %d of %d", n, best, total)
+	if first != nil {
+		msg += ", first error: " + first.Error()
+	}
+	return status.New(status.Aborted, msg)
+}
+
+// Gather 向所有服务端发出请求 返回每个服务端的结果 reply只用来确定回复的类型
+// 结果按照服务列表的顺序排列 不会因为某个服务端失败而取消其他请求
+func (xclient *XClient) Gather(ctx context.Context, serviceMethod string, args, reply interface{}) ([]*Result, error) {
+	if err := checkReply(reply); err != nil {
+		return nil, err
+	}
+	servers, err := xclient.servers()
+	if err != nil {
+		return nil, err
+	}
+	results := xclient.multicast(ctx, servers, serviceMethod, args, reply)
+	byAddr := make(map[string]*Result, len(servers))
+	for range servers {
+		r := <-results
+		byAddr[r.Addr] = r
+	}
+	gathered := make([]*Result, len(servers))
+	for i, addr := range servers {
+		gathered[i] = byAddr[addr]
+	}
+	return gathered, nil
+}
@@ -12,6 +12,7 @@ import (
 	"math/rand"
 	"net/http"
 	"rpc/logger"
+	"rpc/status"
 	"strings"
 	"sync"
 	"time"
@@ -59,7 +60,7 @@ func (d *MultiServerDiscovery) Get(mode SelectMode) (string, error) {
 	defer d.mu.Unlock()
 	n := len(d.servers)
 	if n == 0 {
-		return "", errors.New("rpc discovery: no available servers")
+		return "", status.New(status.Unavailable, "rpc discovery: no available servers")
 	}
 	switch mode {
 	case RandomSelect:
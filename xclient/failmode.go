@@ -0,0 +1,99 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 11:00
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"context"
+	"rpc/status"
+	"sync"
+	"time"
+)
+
+// FailMode 调用失败后的处理方式
+type FailMode int
+
+const (
+	Failfast FailMode = iota // 直接返回错误
+	Failover                 // 换一个服务端重试
+	Failtry                  // 在同一个服务端重试
+)
+
+// FailOption 失败重试的配置
+// 默认只重试能确定请求没有被处理的错误 连接在请求发出后断开时服务端可能已经处理 不会重试
+// 设置了AttemptTimeout并且没有设置Retryable时 单次尝试超时也会重试 只适合幂等的方法
+type FailOption struct {
+	Mode           FailMode
+	Retries        int              // 第一次调用失败后最多重试的次数
+	AttemptTimeout time.Duration    // 每次尝试的超时时间 0表示只受调用的ctx限制
+	Retryable      func(error) bool // 判断错误能否重试 包括单次尝试超时 为空时使用defaultRetryable
+	Budget         *RetryBudget     // 所有调用共享的重试预算 为空时不限制
+}
+
+// DefaultFailOption 失败直接返回 和没有重试时一致
+var DefaultFailOption = FailOption{Mode: Failfast}
+
+// retryable 判断这次尝试的错误能否重试 调用本身已经结束时不重试
+func (o *FailOption) retryable(ctx, attemptCtx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if o.Retryable != nil {
+		return o.Retryable(err)
+	}
+	if attemptCtx.Err() == context.DeadlineExceeded {
+		return true
+	}
+	return defaultRetryable(err)
+}
+
+// defaultRetryable 只有服务端或者客户端明确返回的状态才可以重试 例如服务端正在关闭 限流 熔断 连接失败
+// 从连接错误推断出来的Unavailable不重试 请求可能已经到达服务端
+func defaultRetryable(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && status.IsRetryable(st)
+}
+
+// RetryBudget 重试预算 每次重试消耗一个令牌 成功的调用补充令牌 不足一个令牌时不再重试
+// 避免服务端出问题时所有调用都在重试 进一步放大压力
+type RetryBudget struct {
+	mu     sync.Mutex
+	max    float64
+	ratio  float64
+	tokens float64
+}
+
+// NewRetryBudget maxTokens是令牌上限 也是一开始允许的重试次数 每次成功补充ratio个令牌
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return &RetryBudget{max: maxTokens, ratio: ratio, tokens: maxTokens}
+}
+
+func (b *RetryBudget) onSuccess() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw 取出一个令牌用于重试 不足一个令牌时返回false
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
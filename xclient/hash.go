@@ -0,0 +1,94 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 10:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"rpc/metadata"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultReplicas 每个地址在哈希环上的虚拟节点数
+const DefaultReplicas = 100
+
+// KeyFunc 从调用中取出路由的key 返回空字符串时随机选择地址
+type KeyFunc func(info *PickInfo) string
+
+// MetadataKey 使用outgoing metadata中name对应的值作为key
+func MetadataKey(name string) KeyFunc {
+	return func(info *PickInfo) string {
+		if info == nil || info.Ctx == nil {
+			return ""
+		}
+		md, _ := metadata.FromOutgoingContext(info.Ctx)
+		return md.Get(name)
+	}
+}
+
+type consistentHash struct {
+	key      KeyFunc
+	replicas int
+	mu       sync.Mutex
+	servers  string            // 构建哈希环时的服务列表 列表变化时重新构建
+	ring     []uint32          // 排好序的虚拟节点哈希值
+	nodes    map[uint32]string // 虚拟节点对应的地址
+}
+
+// NewConsistentHash 一致性哈希 相同key的调用总是落在同一个地址上
+// 服务列表变化时只有新增或者删除的地址附近的key会换到别的地址 replicas小于1时使用DefaultReplicas
+func NewConsistentHash(key KeyFunc, replicas int) Balancer {
+	if replicas < 1 {
+		replicas = DefaultReplicas
+	}
+	return &consistentHash{key: key, replicas: replicas}
+}
+
+func (h *consistentHash) build(servers []string) {
+	sorted := append([]string(nil), servers...)
+	sort.Strings(sorted)
+	signature := strings.Join(sorted, ",")
+	if signature == h.servers && h.ring != nil {
+		return
+	}
+	h.servers = signature
+	h.ring = h.ring[:0]
+	h.nodes = make(map[uint32]string, len(sorted)*h.replicas)
+	for _, addr := range sorted {
+		for i := 0; i < h.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + addr))
+			if _, ok := h.nodes[hash]; ok {
+				// 哈希冲突时保留先加入的地址 保证结果和服务列表的顺序无关
+				continue
+			}
+			h.nodes[hash] = addr
+			h.ring = append(h.ring, hash)
+		}
+	}
+	sort.Slice(h.ring, func(i, j int) bool { return h.ring[i] < h.ring[j] })
+}
+
+func (h *consistentHash) Pick(info *PickInfo, servers []string, _ *Stats) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoServers
+	}
+	key := h.key(info)
+	if key == "" {
+		return servers[rand.Intn(len(servers))], nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.build(servers)
+	hash := crc32.ChecksumIEEE([]byte(key))
+	// 顺时针找到第一个虚拟节点
+	i := sort.Search(len(h.ring), func(i int) bool { return h.ring[i] >= hash })
+	return h.nodes[h.ring[i%len(h.ring)]], nil
+}
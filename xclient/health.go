@@ -0,0 +1,269 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 18:10
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"context"
+	"rpc/health"
+	"rpc/logger"
+	"rpc/status"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthOption 主动健康检查和异常摘除的配置
+// 健康检查失败或者调用连续失败的地址会被摘除一段时间 连续被摘除时时长翻倍
+type HealthOption struct {
+	Interval          time.Duration // 主动健康检查的间隔 0表示不做主动检查
+	Timeout           time.Duration // 每次检查的超时时间 为0时使用Interval
+	Service           string        // 检查的服务名 为空表示整个服务端
+	ConsecutiveErrors int           // 调用连续失败多少次后摘除 0表示只根据健康检查摘除
+	BaseEjection      time.Duration // 第一次摘除的时长
+	MaxEjection       time.Duration // 摘除时长的上限 恢复之后这么久没有再被摘除的话 时长重新从BaseEjection开始
+}
+
+// DefaultHealthOption 每10秒检查一次 连续5次调用失败也会摘除
+var DefaultHealthOption = HealthOption{
+	Interval:          10 * time.Second,
+	Timeout:           time.Second,
+	ConsecutiveErrors: 5,
+	BaseEjection:      30 * time.Second,
+	MaxEjection:       5 * time.Minute,
+}
+
+// Ejection 一个被摘除的地址
+type Ejection struct {
+	Addr   string
+	Until  time.Time // 摘除到什么时候
+	Count  int       // 连续被摘除的次数 决定摘除的时长
+	Reason error     // 最近一次被摘除的原因
+}
+
+// outlier 一个地址的摘除状态
+type outlier struct {
+	consecutive int // 连续失败的调用数
+	count       int
+	until       time.Time
+	reason      error
+}
+
+// outliers 所有地址的摘除状态 没有配置时不摘除任何地址
+type outliers struct {
+	mu       sync.Mutex
+	opt      HealthOption
+	m        map[string]*outlier
+	checking bool // 主动检查的协程是否在运行
+}
+
+func newOutliers() *outliers {
+	return &outliers{m: make(map[string]*outlier)}
+}
+
+// setOption 更新配置 返回是否需要启动主动检查的协程
+func (o *outliers) setOption(opt HealthOption) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.opt = opt
+	start := !o.checking && opt.Interval > 0
+	if start {
+		o.checking = true
+	}
+	return start
+}
+
+// nextCheck 主动检查的协程每一轮开始前调用 不需要检查时标记协程已经退出
+func (o *outliers) nextCheck() (HealthOption, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.opt.Interval <= 0 {
+		o.checking = false
+		return o.opt, false
+	}
+	return o.opt, true
+}
+
+func (o *outliers) get(addr string) *outlier {
+	e, ok := o.m[addr]
+	if !ok {
+		e = &outlier{}
+		o.m[addr] = e
+	}
+	return e
+}
+
+// ejected 地址是否正在被摘除
+func (o *outliers) ejected(addr string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.m[addr]
+	return ok && time.Now().Before(e.until)
+}
+
+// filter 去掉被摘除的地址
+func (o *outliers) filter(addrs []string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	rest := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if e, ok := o.m[addr]; !ok || !now.Before(e.until) {
+			rest = append(rest, addr)
+		}
+	}
+	return rest
+}
+
+// record 记录一次调用的结果 连续失败达到阈值时摘除 被取消的调用不影响连续失败的计数
+func (o *outliers) record(addr string, failed bool, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.opt.ConsecutiveErrors <= 0 || canceled(err) {
+		return
+	}
+	e := o.get(addr)
+	if !failed {
+		e.consecutive = 0
+		return
+	}
+	if e.consecutive++; e.consecutive >= o.opt.ConsecutiveErrors {
+		o.ejectLocked(addr, e, err)
+	}
+}
+
+// checked 记录一次健康检查的结果 检查失败时摘除
+func (o *outliers) checked(addr string, err error) {
+	if err == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ejectLocked(addr, o.get(addr), err)
+}
+
+// ejectLocked 摘除地址 已经被摘除时不延长
+func (o *outliers) ejectLocked(addr string, e *outlier, reason error) {
+	now := time.Now()
+	if now.Before(e.until) {
+		return
+	}
+	if e.count > 0 && now.Sub(e.until) >= o.opt.MaxEjection {
+		e.count = 0
+	}
+	e.count++
+	d := o.opt.BaseEjection
+	for i := 1; i < e.count && d < o.opt.MaxEjection; i++ {
+		d *= 2
+	}
+	if o.opt.MaxEjection > 0 && d > o.opt.MaxEjection {
+		d = o.opt.MaxEjection
+	}
+	e.consecutive = 0
+	e.until = now.Add(d)
+	e.reason = reason
+	logger.Logger.Println("rpc xclient: eject", addr, "for", d, "err:", reason)
+}
+
+// retain 清除已经不在服务列表中的地址
+func (o *outliers) retain(addrs []string) {
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for addr := range o.m {
+		if !keep[addr] {
+			delete(o.m, addr)
+		}
+	}
+}
+
+// list 正在被摘除的地址 按地址排序
+func (o *outliers) list() []Ejection {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	var ejections []Ejection
+	for addr, e := range o.m {
+		if now.Before(e.until) {
+			ejections = append(ejections, Ejection{Addr: addr, Until: e.until, Count: e.count, Reason: e.reason})
+		}
+	}
+	sort.Slice(ejections, func(i, j int) bool { return ejections[i].Addr < ejections[j].Addr })
+	return ejections
+}
+
+// SetHealthOption 设置健康检查和异常摘除 配置了检查间隔时会定期检查服务列表中的所有地址
+func (xclient *XClient) SetHealthOption(opt HealthOption) {
+	if xclient.outlier.setOption(opt) {
+		go xclient.checkHealth()
+	}
+}
+
+// Ejected 当前被摘除的地址
+func (xclient *XClient) Ejected() []Ejection {
+	return xclient.outlier.list()
+}
+
+// checkHealth 注册中心只在心跳超时后才删除服务端 这里主动检查 尽快发现不可用的地址
+func (xclient *XClient) checkHealth() {
+	for {
+		opt, ok := xclient.outlier.nextCheck()
+		if !ok {
+			return
+		}
+		select {
+		case <-time.After(opt.Interval):
+		case <-xclient.stop:
+			return
+		}
+		rpcAddrs, err := xclient.d.GetAll()
+		if err != nil {
+			continue
+		}
+		xclient.outlier.retain(rpcAddrs)
+		xclient.retain(rpcAddrs)
+		var wg sync.WaitGroup
+		for _, rpcAddr := range rpcAddrs {
+			wg.Add(1)
+			go func(rpcAddr string) {
+				defer wg.Done()
+				xclient.outlier.checked(rpcAddr, xclient.check(rpcAddr, opt))
+			}(rpcAddr)
+		}
+		wg.Wait()
+	}
+}
+
+// check 对一个地址做一次健康检查 服务不是Serving时也返回错误
+// 旧版本的服务端没有健康检查服务 返回NotFound或者Unimplemented 这时认为是健康的
+func (xclient *XClient) check(rpcAddr string, opt HealthOption) error {
+	timeout := opt.Timeout
+	if timeout <= 0 {
+		timeout = opt.Interval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cli, release, err := xclient.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	defer release()
+	var resp health.CheckResponse
+	if err = cli.Call(ctx, health.CheckMethod, &health.CheckRequest{Service: opt.Service}, &resp); err != nil {
+		if code := status.CodeOf(err); code == status.NotFound || code == status.Unimplemented {
+			return nil
+		}
+		return err
+	}
+	if resp.Status != health.Serving {
+		return status.Errorf(status.Unavailable, "rpc xclient: %s is %v", rpcAddr, resp.Status)
+	}
+	return nil
+}
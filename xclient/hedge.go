@@ -0,0 +1,129 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 14:00
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"rpc/status"
+	"time"
+)
+
+// HedgePolicy 对冲请求的策略 第一个请求迟迟没有回复时向另一个服务端再发一份 使用最先成功的回复
+// 同一个请求可能被多个服务端处理 只能用于幂等的方法
+type HedgePolicy struct {
+	MaxAttempts   int           // 最多发出的请求数 包括第一个 小于2时不对冲
+	Delay         time.Duration // 等待多久没有回复后发出下一个请求
+	LatencyFactor float64       // 大于0并且地址有延迟统计时 等待时间为平均延迟的LatencyFactor倍
+}
+
+// delay 发往这个地址的请求需要等待多久再发出下一个
+func (p *HedgePolicy) delay(stats *EndpointStats) time.Duration {
+	if p.LatencyFactor > 0 {
+		if latency := stats.Latency(); latency > 0 {
+			return time.Duration(float64(latency) * p.LatencyFactor)
+		}
+	}
+	return p.Delay
+}
+
+// SetHedgePolicy 为方法设置对冲策略 设置之后这个方法的调用不再使用FailOption
+// policy.MaxAttempts小于2时取消对冲
+func (xclient *XClient) SetHedgePolicy(serviceMethod string, policy HedgePolicy) {
+	xclient.mu.Lock()
+	defer xclient.mu.Unlock()
+	if policy.MaxAttempts < 2 {
+		delete(xclient.hedges, serviceMethod)
+		return
+	}
+	xclient.hedges[serviceMethod] = policy
+}
+
+// errHedgeExhausted 所有地址都已经发过请求 不再对冲
+var errHedgeExhausted = errors.New("rpc xclient: no untried server for hedging")
+
+// checkReply 对冲和广播需要复制reply reply必须是非空的指针
+func checkReply(reply interface{}) error {
+	v := reflect.ValueOf(reply)
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() {
+		return status.Errorf(status.InvalidArgument, "rpc xclient: reply must be a non-nil pointer, got %T", reply)
+	}
+	return nil
+}
+
+type hedgeResult struct {
+	reply interface{}
+	err   error
+}
+
+// hedge 发出对冲请求 某个请求失败时如果错误可以重试 立即发出下一个请求
+// 和FailOption使用同一个判断 只有明确可以重试的状态才会继续发出请求
+// 返回时取消还没有完成的请求 服务端会收到取消消息
+func (xclient *XClient) hedge(ctx context.Context, policy HedgePolicy, info *PickInfo, args, reply interface{}) error {
+	if err := checkReply(reply); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, policy.MaxAttempts)
+	tried := make(map[string]bool)
+	// launch 选择一个还没有用过的地址发出请求 返回下一个请求之前的等待时间
+	launch := func() (<-chan time.Time, error) {
+		rpcAddr, err := xclient.selectAddr(info, tried)
+		if err != nil {
+			return nil, err
+		}
+		if tried[rpcAddr] {
+			// 所有地址都在tried中时selectAddr会忽略tried 不能把同一个请求再发给这个服务端
+			return nil, errHedgeExhausted
+		}
+		tried[rpcAddr] = true
+		copyReply := reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+		go func() {
+			err := xclient.call(rpcAddr, ctx, info.ServiceMethod, args, copyReply)
+			results <- hedgeResult{reply: copyReply, err: err}
+		}()
+		return time.After(policy.delay(xclient.stats.Get(rpcAddr))), nil
+	}
+	next, err := launch()
+	if err != nil {
+		return err
+	}
+	sent, pending := 1, 1
+	var lastErr, fatalErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(r.reply).Elem())
+				return nil
+			}
+			lastErr = r.err
+			if fatalErr == nil && !defaultRetryable(r.err) {
+				// 不能重试的错误不再发出新的请求 但已经发出的请求仍然可能成功
+				fatalErr = r.err
+			}
+		case <-next:
+		}
+		// 等待超时或者请求失败 发出下一个请求
+		if fatalErr == nil && sent < policy.MaxAttempts && ctx.Err() == nil {
+			if next, err = launch(); err == nil {
+				sent++
+				pending++
+				continue
+			}
+		}
+		next = nil
+	}
+	if fatalErr != nil {
+		return fatalErr
+	}
+	return lastErr
+}
@@ -0,0 +1,216 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 23:20
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"errors"
+	"rpc/client"
+	"rpc/option"
+	"sync"
+	"time"
+)
+
+// PoolMode 连接池中选择连接的方式
+type PoolMode int
+
+const (
+	LeastPendingPool PoolMode = iota // 选择未完成调用最少的连接
+	RoundRobinPool                   // 依次使用每个连接
+)
+
+// PoolOption 每个地址的连接池配置
+type PoolOption struct {
+	Size        int           // 每个地址最多的连接数 小于1时按1处理
+	Mode        PoolMode      // 选择连接的方式
+	IdleTimeout time.Duration // 连接空闲超过这个时间后关闭 0表示不关闭
+	MaxLifetime time.Duration // 连接建立超过这个时间后不再使用 没有未完成的调用时关闭 0表示不限制
+}
+
+// DefaultPoolOption 每个地址一个连接 和没有连接池时一致
+var DefaultPoolOption = PoolOption{Size: 1}
+
+type pooledClient struct {
+	cli      *client.Client
+	created  time.Time
+	lastUsed time.Time
+	reserved int // 已经选中这个连接但还没有结束的调用 在p.mu内增减 清理时不会关闭被占用的连接
+}
+
+// errPoolClosed 连接池已经被清理 需要重新取一个连接池
+var errPoolClosed = errors.New("rpc xclient: pool is closed")
+
+// pool 一个地址的连接池 建立连接时不持有任何锁 慢的地址不会影响其他地址
+type pool struct {
+	addr    string
+	dialMu  sync.Mutex // 同一个地址同时只建立一个连接
+	mu      sync.Mutex // 保护下面的字段
+	conns   []*pooledClient
+	retired []*pooledClient // 超过最大生命周期 等待调用完成后关闭
+	next    int
+	dialing bool // 正在建立新的连接
+	closed  bool
+}
+
+// pruneIdle 清理连接 连接池空了并且没有在建立连接时关闭连接池 返回是否已经关闭
+func (p *pool) pruneIdle(opt PoolOption, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune(opt, now)
+	if len(p.conns) == 0 && len(p.retired) == 0 && !p.dialing {
+		p.closed = true
+	}
+	return p.closed
+}
+
+// prune 清理断开 空闲和超过生命周期的连接 需要持有p.mu
+func (p *pool) prune(opt PoolOption, now time.Time) {
+	conns := p.conns[:0]
+	for _, pc := range p.conns {
+		switch {
+		case !pc.cli.IsValid():
+			_ = pc.cli.Close()
+		case opt.MaxLifetime > 0 && now.Sub(pc.created) > opt.MaxLifetime:
+			p.retired = append(p.retired, pc)
+		case opt.IdleTimeout > 0 && now.Sub(pc.lastUsed) > opt.IdleTimeout && pc.reserved == 0:
+			_ = pc.cli.Close()
+		default:
+			conns = append(conns, pc)
+		}
+	}
+	p.conns = conns
+	retired := p.retired[:0]
+	for _, pc := range p.retired {
+		if pc.reserved == 0 {
+			_ = pc.cli.Close()
+		} else {
+			retired = append(retired, pc)
+		}
+	}
+	p.retired = retired
+}
+
+// reserveLocked 占用选中的连接 调用结束后需要调用返回的函数释放
+func (p *pool) reserveLocked(pc *pooledClient, now time.Time) func() {
+	pc.reserved++
+	pc.lastUsed = now
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		pc.reserved--
+		pc.lastUsed = time.Now()
+	}
+}
+
+// get 选出一个连接并占用 连接数没有达到上限并且现有的连接都在忙时建立新的连接
+// 已经有其他调用在建立连接时 使用现有的连接 没有连接的话等待建立完成
+// 调用结束后需要调用release 在此之前连接不会被清理关闭
+func (p *pool) get(opt PoolOption, dialOpt *option.Option) (cli *client.Client, release func(), err error) {
+	p.mu.Lock()
+	cli, release, err = p.pickLocked(opt, p.dialing)
+	p.mu.Unlock()
+	if cli != nil || err != nil {
+		return cli, release, err
+	}
+	p.dialMu.Lock()
+	defer p.dialMu.Unlock()
+	p.mu.Lock()
+	if cli, release, err = p.pickLocked(opt, false); cli != nil || err != nil {
+		p.mu.Unlock()
+		return cli, release, err
+	}
+	p.dialing = true
+	p.mu.Unlock()
+
+	cli, err = client.XDial(p.addr, dialOpt)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing = false
+	now := time.Now()
+	if p.closed {
+		if cli != nil {
+			_ = cli.Close()
+		}
+		return nil, nil, errPoolClosed
+	}
+	if err != nil {
+		if len(p.conns) > 0 {
+			// 新建连接失败时继续使用已有的连接
+			picked := p.conns[0]
+			return picked.cli, p.reserveLocked(picked, now), nil
+		}
+		return nil, nil, err
+	}
+	pc := &pooledClient{cli: cli, created: now}
+	p.conns = append(p.conns, pc)
+	return cli, p.reserveLocked(pc, now), nil
+}
+
+// pickLocked 从现有的连接中选择并占用 返回nil表示需要建立新的连接 busy为true时忙的连接也可以使用
+func (p *pool) pickLocked(opt PoolOption, busy bool) (*client.Client, func(), error) {
+	if p.closed {
+		return nil, nil, errPoolClosed
+	}
+	now := time.Now()
+	p.prune(opt, now)
+	size := opt.Size
+	if size < 1 {
+		size = 1
+	}
+	var picked *pooledClient
+	if len(p.conns) > 0 {
+		switch opt.Mode {
+		case RoundRobinPool:
+			if len(p.conns) == size {
+				picked = p.conns[p.next%len(p.conns)]
+				p.next++
+			}
+		default:
+			picked = p.conns[0]
+			for _, pc := range p.conns[1:] {
+				if pc.reserved < picked.reserved {
+					picked = pc
+				}
+			}
+			if picked.reserved > 0 && len(p.conns) < size && !busy {
+				picked = nil
+			}
+		}
+	}
+	if picked == nil && busy && len(p.conns) > 0 {
+		picked = p.conns[0]
+	}
+	if picked == nil {
+		return nil, nil, nil
+	}
+	return picked.cli, p.reserveLocked(picked, now), nil
+}
+
+// draining 服务端会在所有连接上发送关闭通知 任意一个连接收到就说明服务端正在关闭
+func (p *pool) draining() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pc := range p.conns {
+		if pc.cli.Draining() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, pc := range p.conns {
+		_ = pc.cli.Close()
+	}
+	for _, pc := range p.retired {
+		_ = pc.cli.Close()
+	}
+	p.conns, p.retired = nil, nil
+}
@@ -0,0 +1,127 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/17 09:10
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"sync"
+	"time"
+)
+
+// ewmaAlpha 新的延迟样本在平均值中的权重
+const ewmaAlpha = 0.3
+
+// 失败的调用按惩罚延迟计入平均值 否则总是失败或者超时的地址会一直看起来很快
+const (
+	failurePenalty    = 100 * time.Millisecond // 还没有样本时失败调用至少按这个延迟计算
+	failurePenaltyMul = 2                      // 有样本时失败调用至少按平均延迟的这个倍数计算
+	maxLatency        = time.Minute            // 平均延迟的上限 避免连续失败时溢出
+)
+
+// EndpointStats 一个地址的调用统计 由XClient在每次调用前后更新
+type EndpointStats struct {
+	mu          sync.Mutex
+	outstanding int
+	ewma        float64 // 延迟的指数加权平均 单位纳秒 0表示还没有样本
+	calls       uint64
+	failures    uint64
+}
+
+func (e *EndpointStats) start() {
+	e.mu.Lock()
+	e.outstanding++
+	e.mu.Unlock()
+}
+
+func (e *EndpointStats) done(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.outstanding--
+	e.calls++
+	sample := float64(latency)
+	if err != nil {
+		// 失败的调用可能很快返回 按惩罚延迟计算 连续失败时平均值不断增大
+		e.failures++
+		penalty := float64(failurePenalty)
+		if e.ewma > 0 {
+			penalty = failurePenaltyMul * e.ewma
+		}
+		if sample < penalty {
+			sample = penalty
+		}
+	}
+	if e.ewma == 0 {
+		e.ewma = sample
+	} else {
+		e.ewma = ewmaAlpha*sample + (1-ewmaAlpha)*e.ewma
+	}
+	if e.ewma > float64(maxLatency) {
+		e.ewma = float64(maxLatency)
+	}
+}
+
+// Outstanding 正在进行的调用数
+func (e *EndpointStats) Outstanding() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.outstanding
+}
+
+// Latency 调用延迟的加权平均 失败的调用按惩罚延迟计算 没有样本时为0
+func (e *EndpointStats) Latency() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.ewma)
+}
+
+// Counts 调用总数和失败数
+func (e *EndpointStats) Counts() (calls, failures uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls, e.failures
+}
+
+// Stats 所有地址的统计
+type Stats struct {
+	mu        sync.Mutex
+	endpoints map[string]*EndpointStats
+}
+
+func newStats() *Stats {
+	return &Stats{endpoints: make(map[string]*EndpointStats)}
+}
+
+// Get 地址的统计 没有调用过的地址返回空的统计
+func (s *Stats) Get(addr string) *EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.endpoints[addr]
+	if !ok {
+		e = &EndpointStats{}
+		s.endpoints[addr] = e
+	}
+	return e
+}
+
+// retain 删除已经不在服务列表中的地址的统计
+// 统计只会为服务列表中的地址创建 数量没有超过服务列表时不需要遍历
+func (s *Stats) retain(addrs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.endpoints) <= len(addrs) {
+		return
+	}
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	for addr := range s.endpoints {
+		if !keep[addr] {
+			delete(s.endpoints, addr)
+		}
+	}
+}
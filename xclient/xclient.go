@@ -9,18 +9,31 @@ package xclient
 
 import (
 	"context"
+	"errors"
+	"math/rand"
 	"reflect"
 	"rpc/client"
+	"rpc/metadata"
 	"rpc/option"
+	"rpc/status"
 	"sync"
+	"time"
 )
 
 type XClient struct {
-	d       Discovery                 // 服务
-	mode    SelectMode                // 选择的模式
-	clients map[string]*client.Client // 客户端集合
-	mu      sync.RWMutex              // 读写锁
-	opt     *option.Option            // 选项
+	d       Discovery              // 服务
+	mode    SelectMode             // 选择的模式
+	clients map[string]*pool       // 每个地址的连接池
+	mu      sync.RWMutex           // 读写锁
+	opt     *option.Option         // 选项 其中的拦截器会用在每个地址对应的客户端上
+	poolOpt PoolOption             // 连接池配置
+	stop    chan struct{}          // 关闭时停止清理空闲连接的协程
+	lb      Balancer               // 不为空时代替选择模式选出地址
+	stats   *Stats                 // 每个地址的调用统计
+	failOpt FailOption             // 失败重试的配置
+	hedges  map[string]HedgePolicy // 每个方法的对冲策略
+	breaker *breakers              // 每个地址的熔断器
+	outlier *outliers              // 健康检查失败或者连续出错被摘除的地址
 }
 
 func NewXClient(d Discovery, mode SelectMode, opt *option.Option) *XClient {
@@ -28,66 +41,281 @@ func NewXClient(d Discovery, mode SelectMode, opt *option.Option) *XClient {
 		d:       d,
 		mode:    mode,
 		opt:     opt,
-		clients: make(map[string]*client.Client),
+		clients: make(map[string]*pool),
+		poolOpt: DefaultPoolOption,
+		stop:    make(chan struct{}),
+		stats:   newStats(),
+		failOpt: DefaultFailOption,
+		hedges:  make(map[string]HedgePolicy),
+		breaker: newBreakers(),
+		outlier: newOutliers(),
+	}
+}
+
+// SetFailOption 设置调用失败后的重试方式 只对Call生效
+func (xclient *XClient) SetFailOption(opt FailOption) {
+	xclient.mu.Lock()
+	defer xclient.mu.Unlock()
+	xclient.failOpt = opt
+}
+
+// SetBreakerOption 设置每个地址的熔断器 会清空已有的熔断状态
+func (xclient *XClient) SetBreakerOption(opt BreakerOption) {
+	xclient.breaker.setOption(opt)
+}
+
+// Breaker 地址的熔断器状态
+func (xclient *XClient) Breaker(rpcAddr string) BreakerState {
+	return xclient.breaker.state(rpcAddr)
+}
+
+// SetBalancer 设置负载均衡策略 设置之后不再使用选择模式
+func (xclient *XClient) SetBalancer(lb Balancer) {
+	xclient.mu.Lock()
+	defer xclient.mu.Unlock()
+	xclient.lb = lb
+}
+
+// Stats 每个地址的调用统计
+func (xclient *XClient) Stats() *Stats {
+	return xclient.stats
+}
+
+// SetPoolOption 设置每个地址的连接池 配置了空闲时间时会定期清理空闲连接
+func (xclient *XClient) SetPoolOption(opt PoolOption) {
+	xclient.mu.Lock()
+	defer xclient.mu.Unlock()
+	start := xclient.poolOpt.IdleTimeout <= 0 && opt.IdleTimeout > 0
+	xclient.poolOpt = opt
+	if start {
+		go xclient.evictIdle()
+	}
+}
+
+// evictIdle 没有调用时连接池不会被访问 需要定期清理空闲的连接
+func (xclient *XClient) evictIdle() {
+	for {
+		xclient.mu.RLock()
+		interval := xclient.poolOpt.IdleTimeout / 2
+		xclient.mu.RUnlock()
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-xclient.stop:
+			return
+		}
+		xclient.mu.Lock()
+		now := time.Now()
+		for addr, p := range xclient.clients {
+			if p.pruneIdle(xclient.poolOpt, now) {
+				delete(xclient.clients, addr)
+			}
+		}
+		xclient.mu.Unlock()
 	}
 }
 
 func (xclient *XClient) Close() error {
 	xclient.mu.Lock()
 	defer xclient.mu.Unlock()
-	for name, client := range xclient.clients {
-		_ = client.Close()
+	select {
+	case <-xclient.stop:
+	default:
+		close(xclient.stop)
+	}
+	for name, p := range xclient.clients {
+		p.close()
 		delete(xclient.clients, name)
 	}
 	return nil
 }
 
-// 传入rpc地址发起一个会话
-func (xclent *XClient) dial(rpcAddr string) (*client.Client, error) {
-	// 这里要整个过程全部锁住 不然for循环加广播 会同时创建10个连接 其实用到的只有两个连接
-	xclent.mu.Lock()
-	defer xclent.mu.Unlock()
-	// 延迟初始化
-	//if xclent.clients == nil {
-	//	xclent.clients = make(map[string]*client.Client)
-	//}
-	// 如果这个地址指定的会话不存在的话
-	cli, ok := xclent.clients[rpcAddr]
-	// 如果能取出 判断是否有效
-	// 如果有因为错误关闭的话 清除然后重新创建一个新的连接 FIXME
-	if ok && !cli.IsValid() {
-		_ = cli.Close()
-		cli = nil
-		delete(xclent.clients, rpcAddr)
-	}
-	// 调用xDial重新建立一次连接 并存入map中去
-	if cli == nil {
-		var err error
-		cli, err = client.XDial(rpcAddr, xclent.opt)
-		if err != nil {
-			return nil, err
+// 传入rpc地址发起一个会话 调用结束后需要调用release 释放之前连接不会被清理
+func (xclent *XClient) dial(rpcAddr string) (cli *client.Client, release func(), err error) {
+	for {
+		// 只在锁内找到或者创建连接池 建立连接时不持有XClient的锁 慢的地址不会阻塞其他调用
+		// 同一个地址的连接池自己保证不会同时创建多余的连接
+		xclent.mu.Lock()
+		select {
+		case <-xclent.stop:
+			xclent.mu.Unlock()
+			return nil, nil, client.ErrShutdown
+		default:
+		}
+		p, ok := xclent.clients[rpcAddr]
+		if !ok {
+			p = &pool{addr: rpcAddr}
+			xclent.clients[rpcAddr] = p
+		}
+		poolOpt, opt := xclent.poolOpt, xclent.opt
+		xclent.mu.Unlock()
+		// 连接池会清除因为错误关闭的连接 需要时调用XDial重新建立连接
+		cli, release, err = p.get(poolOpt, opt)
+		if err != errPoolClosed {
+			return cli, release, err
 		}
-		xclent.clients[rpcAddr] = cli
+		// 连接池刚好被清理 重新取一个
 	}
-	// 返回刚才建立的client
-	return cli, nil
 }
 
 func (xclent *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	cli, err := xclent.dial(rpcAddr)
+	ok, probe := xclent.breaker.allow(rpcAddr)
+	if !ok {
+		return ErrBreakerOpen
+	}
+	cli, release, err := xclent.dial(rpcAddr)
 	if err != nil {
-		return err
+		xclent.breaker.fail(rpcAddr, probe)
+		xclent.outlier.record(rpcAddr, true, err)
+		// 连接没有建立 请求一定没有发出 可以放心重试
+		return status.Errorf(status.Unavailable, "rpc xclient: dial %s: %v", rpcAddr, err)
 	}
-	return cli.Call(ctx, serviceMethod, args, reply)
+	defer release()
+	stats := xclent.stats.Get(rpcAddr)
+	stats.start()
+	start := time.Now()
+	err = cli.Call(ctx, serviceMethod, args, reply)
+	stats.done(time.Since(start), err)
+	xclent.breaker.record(rpcAddr, probe, err)
+	xclent.outlier.record(rpcAddr, err != nil && serverFailure(err), err)
+	return err
 }
 
-// Call 最后再加入一层选择模式
-func (xclient *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+// draining 判断地址对应的服务端是否正在关闭
+func (xclient *XClient) draining(rpcAddr string) bool {
+	xclient.mu.RLock()
+	defer xclient.mu.RUnlock()
+	p, ok := xclient.clients[rpcAddr]
+	return ok && p.draining()
+}
+
+// selectAddr 选出一个地址 跳过正在关闭的服务端和exclude中的地址 设置了负载均衡策略时由策略选择
+// 所有地址都在exclude中时忽略exclude
+func (xclient *XClient) selectAddr(info *PickInfo, exclude map[string]bool) (string, error) {
+	xclient.mu.RLock()
+	lb := xclient.lb
+	xclient.mu.RUnlock()
+	if lb != nil {
+		servers, err := xclient.available(exclude)
+		if err != nil {
+			return "", err
+		}
+		return lb.Pick(info, servers, xclient.stats)
+	}
 	rpcAddr, err := xclient.d.Get(xclient.mode)
+	if err != nil || !xclient.draining(rpcAddr) && xclient.breaker.ready(rpcAddr) &&
+		!xclient.outlier.ejected(rpcAddr) && !exclude[rpcAddr] {
+		return rpcAddr, err
+	}
+	servers, err := xclient.available(exclude)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if len(servers) == 0 {
+		return "", ErrNoServers
+	}
+	// 随机选择 不能总是选第一个 否则跳过的地址的流量会全部压到同一个服务端上
+	return servers[rand.Intn(len(servers))], nil
+}
+
+// retain 删除已经离开服务列表的地址的统计和负载均衡状态 否则注册中心频繁变化时会一直增长
+func (xclient *XClient) retain(rpcAddrs []string) {
+	xclient.stats.retain(rpcAddrs)
+	xclient.mu.RLock()
+	lb := xclient.lb
+	xclient.mu.RUnlock()
+	if r, ok := lb.(retainer); ok {
+		r.retain(rpcAddrs)
+	}
+}
+
+// available 服务列表中可以选择的地址 跳过正在关闭 熔断和被摘除的服务端
+func (xclient *XClient) available(exclude map[string]bool) ([]string, error) {
+	rpcAddrs, err := xclient.d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	xclient.retain(rpcAddrs)
+	servers := make([]string, 0, len(rpcAddrs))
+	for _, addr := range rpcAddrs {
+		if !xclient.draining(addr) {
+			servers = append(servers, addr)
+		}
+	}
+	if len(servers) == 0 && len(rpcAddrs) > 0 {
+		return nil, status.New(status.Unavailable, "rpc xclient: all servers are draining")
+	}
+	closed := make([]string, 0, len(servers))
+	for _, addr := range servers {
+		if xclient.breaker.ready(addr) {
+			closed = append(closed, addr)
+		}
+	}
+	if len(closed) == 0 && len(servers) > 0 {
+		return nil, ErrBreakerOpen
+	}
+	servers = closed
+	// 全部被摘除时忽略摘除 避免没有服务端可用
+	if healthy := xclient.outlier.filter(servers); len(healthy) > 0 {
+		servers = healthy
+	}
+	if len(exclude) > 0 {
+		rest := make([]string, 0, len(servers))
+		for _, addr := range servers {
+			if !exclude[addr] {
+				rest = append(rest, addr)
+			}
+		}
+		if len(rest) > 0 {
+			servers = rest
+		}
+	}
+	return servers, nil
+}
+
+// Call 最后再加入一层选择模式 失败后按照FailOption重试
+func (xclient *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	xclient.mu.RLock()
+	fo := xclient.failOpt
+	policy, hedged := xclient.hedges[serviceMethod]
+	xclient.mu.RUnlock()
+	info := &PickInfo{Ctx: ctx, ServiceMethod: serviceMethod, Args: args}
+	if hedged {
+		return xclient.hedge(ctx, policy, info, args, reply)
+	}
+	tried := make(map[string]bool)
+	var rpcAddr string
+	reselect := true
+	for attempt := 0; ; attempt++ {
+		if reselect {
+			var err error
+			if rpcAddr, err = xclient.selectAddr(info, tried); err != nil {
+				return err
+			}
+		}
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if fo.AttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, fo.AttemptTimeout)
+		}
+		err := xclient.call(rpcAddr, attemptCtx, serviceMethod, args, reply)
+		retryable := err != nil && fo.retryable(ctx, attemptCtx, err)
+		cancel()
+		if err == nil {
+			fo.Budget.onSuccess()
+			return nil
+		}
+		if fo.Mode == Failfast || !retryable {
+			return err
+		}
+		if attempt >= fo.Retries || !fo.Budget.withdraw() {
+			return err
+		}
+		tried[rpcAddr] = true
+		// Failtry在熔断器拒绝时也要换一个服务端 否则剩下的重试都会得到同样的错误
+		reselect = fo.Mode == Failover || errors.Is(err, ErrBreakerOpen)
 	}
-	return xclient.call(rpcAddr, ctx, serviceMethod, args, reply)
 }
 
 // BroadCast 广播函数
@@ -96,6 +324,8 @@ func (xclient *XClient) BroadCast(ctx context.Context, serviceMethod string, arg
 	if err != nil {
 		return err
 	}
+	// 每个调用单独接收trailer 最后使用回复对应的trailer
+	target := metadata.TrailerTarget(ctx)
 	ctx, cancel := context.WithCancel(ctx)
 	var e error
 	var replyDone = false
@@ -105,7 +335,8 @@ func (xclient *XClient) BroadCast(ctx context.Context, serviceMethod string, arg
 		wg.Add(1)
 		go func(rpcAddr string) {
 			copyReply := reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
-			err := xclient.call(rpcAddr, ctx, serviceMethod, args, copyReply)
+			var trailer metadata.MD
+			err := xclient.call(rpcAddr, metadata.ReceiveTrailer(ctx, &trailer), serviceMethod, args, copyReply)
 			mu.Lock()
 			if err != nil && e == nil {
 				//logger.Logger.Println("addr ", rpcAddr, "error:", err)
@@ -115,6 +346,9 @@ func (xclient *XClient) BroadCast(ctx context.Context, serviceMethod string, arg
 			if err == nil && !replyDone {
 				replyDone = true
 				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(copyReply).Elem())
+				if target != nil {
+					*target = trailer
+				}
 			}
 			mu.Unlock()
 			defer wg.Done()
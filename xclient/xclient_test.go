@@ -0,0 +1,554 @@
+/**
+ * @Author: yzy
+ * @Description:
+ * @Version: 1.0.0
+ * @Date: 2026/10/16 23:40
+ * @Copyright: MIN-Group；国家重大科技基础设施——未来网络北大实验室；深圳市信息论与未来网络重点实验室
+ */
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"rpc/client"
+	"rpc/health"
+	"rpc/metadata"
+	"rpc/option"
+	"rpc/server"
+	"rpc/status"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Sleep 等待Num1毫秒后返回
+func (f Foo) Sleep(ctx context.Context, args Args, reply *int) error {
+	select {
+	case <-time.After(time.Duration(args.Num1) * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Wait 等待f毫秒后返回 不同的服务端可以注册不同的延迟
+func (f Foo) Wait(ctx context.Context, args Args, reply *int) error {
+	return f.Sleep(ctx, Args{Num1: int(f), Num2: args.Num2}, reply)
+}
+
+// Reject f为0时立即返回不能重试的错误 否则和Wait一样
+func (f Foo) Reject(ctx context.Context, args Args, reply *int) error {
+	if f == 0 {
+		return status.New(status.FailedPrecondition, "rejected")
+	}
+	return f.Wait(ctx, args, reply)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+// startServer 启动一个服务端 返回tcp@地址
+func startServer(t *testing.T, ins interface{}) (string, *server.Server) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen tcp")
+	}
+	s := server.NewServer()
+	s.RegisterService(ins)
+	go s.Accept(l)
+	return "tcp@" + l.Addr().String(), s
+}
+
+func TestPool(t *testing.T) {
+	var foo Foo
+	addr, s := startServer(t, &foo)
+	defer func() { _ = s.Close() }()
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetPoolOption(PoolOption{Size: 3, Mode: LeastPendingPool, IdleTimeout: 150 * time.Millisecond})
+
+	// 并发的慢调用会用满连接池
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			err := xc.Call(context.Background(), "Foo.Sleep", &Args{Num1: 50}, &reply)
+			_assert(err == nil, "call failed: %v", err)
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	xc.mu.RLock()
+	n := len(xc.clients[addr].conns)
+	xc.mu.RUnlock()
+	_assert(n == 3, "expect 3 pooled connections, got %d", n)
+
+	// 空闲连接会被清理
+	time.Sleep(400 * time.Millisecond)
+	xc.mu.RLock()
+	_, ok := xc.clients[addr]
+	xc.mu.RUnlock()
+	_assert(!ok, "idle connections should be evicted")
+	var reply int
+	err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call after eviction failed: %v", err)
+	calls, _ := xc.Stats().Get(addr).Counts()
+	_assert(calls == 7, "expect 7 calls in stats, got %d", calls)
+
+	// 选中之后还没有发出请求的连接也不会被清理关闭
+	p := &pool{addr: addr}
+	opt := PoolOption{Size: 1, MaxLifetime: time.Millisecond, IdleTimeout: time.Millisecond}
+	_, release, err := p.get(opt, nil)
+	_assert(err == nil, "failed to get a client: %v", err)
+	time.Sleep(5 * time.Millisecond)
+	_assert(!p.pruneIdle(opt, time.Now()) && len(p.retired) == 1, "reserved client should not be closed")
+	release()
+	_assert(p.pruneIdle(opt, time.Now()) && len(p.retired) == 0, "released client should be closed")
+}
+
+func TestSlowDial(t *testing.T) {
+	var foo Foo
+	addr, s := startServer(t, &foo)
+	defer func() { _ = s.Close() }()
+	// 只监听不接收连接 握手永远不会完成
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	dialed := make(chan struct{})
+	go func() {
+		_, _, _ = xc.dial("tcp@" + l.Addr().String())
+		close(dialed)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// 慢的地址正在建立连接时 其他地址的调用不受影响
+	done := make(chan error, 1)
+	go func() {
+		var reply int
+		done <- xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	}()
+	select {
+	case err := <-done:
+		_assert(err == nil, "call failed: %v", err)
+	case <-time.After(time.Second):
+		_assert(false, "call blocked by a slow dial")
+	}
+	_ = l.Close()
+	<-dialed
+}
+
+// TestInterceptors XClient建立的连接使用option中配置的客户端拦截器
+func TestInterceptors(t *testing.T) {
+	var foo Foo
+	addr1, s1 := startServer(t, &foo)
+	defer func() { _ = s1.Close() }()
+	addr2, s2 := startServer(t, &foo)
+	defer func() { _ = s2.Close() }()
+	var mu sync.Mutex
+	var methods []string
+	record := func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker option.Invoker) error {
+		mu.Lock()
+		methods = append(methods, serviceMethod)
+		mu.Unlock()
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+	opt := &option.Option{Interceptors: []option.Interceptor{record}}
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr1, addr2}), RoundRobinSelect, opt)
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call failed: %v", err)
+	mu.Lock()
+	n := len(methods)
+	mu.Unlock()
+	_assert(n == 1 && methods[0] == "Foo.Sum", "interceptor should run once on Call, got %v", methods)
+
+	// 广播时每个服务端的调用都经过拦截器
+	err = xc.BroadCast(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil, "broadcast failed: %v", err)
+	mu.Lock()
+	defer mu.Unlock()
+	_assert(len(methods) == 3, "interceptor should run on every broadcast call, got %v", methods)
+}
+
+func TestBalancer(t *testing.T) {
+	servers := []string{"a", "b"}
+	stats := newStats()
+	counts := map[string]int{}
+	wrr := NewWeightedRoundRobin(map[string]int{"a": 3})
+	for i := 0; i < 8; i++ {
+		addr, _ := wrr.Pick(nil, servers, stats)
+		counts[addr]++
+	}
+	_assert(counts["a"] == 6 && counts["b"] == 2, "wrong weighted round robin %v", counts)
+
+	// a上有一个正在进行的调用
+	stats.Get("a").start()
+	for _, lb := range []Balancer{NewLeastOutstanding(), NewPowerOfTwoChoices()} {
+		addr, err := lb.Pick(nil, servers, stats)
+		_assert(err == nil && addr == "b", "expect the less loaded server, got %s", addr)
+	}
+	stats.Get("a").done(time.Millisecond, nil)
+	stats.Get("b").start()
+	stats.Get("b").done(10*time.Millisecond, nil)
+	addr, _ := NewLatencyEWMA().Pick(nil, servers, stats)
+	_assert(addr == "a", "expect the faster server, got %s", addr)
+	_, err := NewLatencyEWMA().Pick(nil, nil, stats)
+	_assert(err == ErrNoServers, "expect no servers error, got %v", err)
+
+	// 总是出错的服务端不能因为失败返回得快就被当成最快的地址
+	var foo Foo
+	good, s1 := startServer(t, &foo)
+	defer func() { _ = s1.Close() }()
+	bad, s2 := startServer(t, &foo)
+	defer func() { _ = s2.Close() }()
+	s2.Use(func(ctx context.Context, info *server.RequestInfo, next server.Handler) error {
+		return status.New(status.Unavailable, "broken")
+	})
+	xc := NewXClient(NewMultiServerDiscovery([]string{good, bad}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBalancer(NewLatencyEWMA())
+	for i := 0; i < 20; i++ {
+		var reply int
+		_ = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: i}, &reply)
+	}
+	calls, failures := xc.Stats().Get(bad).Counts()
+	_assert(calls == failures && calls <= 2, "broken server got %d calls", calls)
+	_assert(xc.Stats().Get(bad).Latency() >= failurePenalty, "failures should be penalized")
+
+	// 离开服务列表的地址的统计和轮询状态要删除
+	d := NewMultiServerDiscovery([]string{good, bad})
+	xc = NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	wrr = NewWeightedRoundRobin(nil)
+	xc.SetBalancer(wrr)
+	for i := 0; i < 4; i++ {
+		var reply int
+		_ = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: i}, &reply)
+	}
+	_ = d.Update([]string{good})
+	var reply int
+	err = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1}, &reply)
+	_assert(err == nil, "call failed: %v", err)
+	xc.stats.mu.Lock()
+	_, ok := xc.stats.endpoints[bad]
+	xc.stats.mu.Unlock()
+	_, current := wrr.(*weightedRoundRobin).current[bad]
+	_assert(!ok && !current, "state of the removed server should be pruned")
+}
+
+func TestConsistentHash(t *testing.T) {
+	lb := NewConsistentHash(func(info *PickInfo) string { return fmt.Sprint(info.Args) }, 0)
+	pick := func(servers []string, key int) string {
+		addr, err := lb.Pick(&PickInfo{Args: key}, servers, nil)
+		_assert(err == nil, "pick failed: %v", err)
+		return addr
+	}
+	before := []string{"a", "b", "c"}
+	after := []string{"d", "c", "b", "a"}
+	moved := 0
+	for key := 0; key < 1000; key++ {
+		old := pick(before, key)
+		_assert(pick(before, key) == old, "same key should land on the same server")
+		if addr := pick(after, key); addr != old {
+			_assert(addr == "d", "key %d moved from %s to %s", key, old, addr)
+			moved++
+		}
+	}
+	_assert(moved > 0 && moved < 400, "too many keys moved: %d", moved)
+
+	// 通过metadata中的key路由
+	key := MetadataKey("user-id")
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("user-id", "42"))
+	_assert(key(&PickInfo{Ctx: ctx}) == "42" && key(&PickInfo{Ctx: context.Background()}) == "", "wrong metadata key")
+}
+
+func TestFailMode(t *testing.T) {
+	var foo Foo
+	alive, s := startServer(t, &foo)
+	defer func() { _ = s.Close() }()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen tcp: %v", err)
+	dead := "tcp@" + l.Addr().String()
+	_ = l.Close()
+
+	xc := NewXClient(NewMultiServerDiscovery([]string{dead, alive}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var reply int
+	// 轮询时两次调用中有一次选中关闭的服务端
+	failed := 0
+	for i := 0; i < 2; i++ {
+		if err = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			_assert(status.CodeOf(err) == status.Unavailable, "expect Unavailable, got %v", err)
+			failed++
+		}
+	}
+	_assert(failed == 1, "failfast should return the error once, got %d", failed)
+
+	xc.SetFailOption(FailOption{Mode: Failover, Retries: 1})
+	for i := 0; i < 4; i++ {
+		err = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "failover should retry another server: %v", err)
+	}
+
+	// 在同一个服务端上重试 每次尝试单独超时
+	xc = NewXClient(NewMultiServerDiscovery([]string{alive}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetFailOption(FailOption{Mode: Failtry, Retries: 2, AttemptTimeout: 20 * time.Millisecond})
+	err = xc.Call(context.Background(), "Foo.Sleep", &Args{Num1: 200}, &reply)
+	calls, failures := xc.Stats().Get(alive).Counts()
+	_assert(err != nil && calls == 3 && failures == 3, "expect 3 timed out attempts, got %d %d %v", calls, failures, err)
+
+	// 预算一开始允许两次重试 用完后不再重试
+	xc.SetFailOption(FailOption{Mode: Failtry, Retries: 2, AttemptTimeout: 20 * time.Millisecond, Budget: NewRetryBudget(2, 0.1)})
+	_ = xc.Call(context.Background(), "Foo.Sleep", &Args{Num1: 200}, &reply)
+	calls, _ = xc.Stats().Get(alive).Counts()
+	_assert(calls == 6, "budget should allow two retries, got %d calls", calls)
+	_ = xc.Call(context.Background(), "Foo.Sleep", &Args{Num1: 200}, &reply)
+	calls, _ = xc.Stats().Get(alive).Counts()
+	_assert(calls == 7, "budget should stop retries, got %d calls", calls)
+
+	// 调用方指定不能重试时 单次尝试超时也不重试
+	xc.SetFailOption(FailOption{Mode: Failtry, Retries: 2, AttemptTimeout: 20 * time.Millisecond, Retryable: func(error) bool { return false }})
+	_ = xc.Call(context.Background(), "Foo.Sleep", &Args{Num1: 200}, &reply)
+	calls, _ = xc.Stats().Get(alive).Counts()
+	_assert(calls == 8, "non-retryable call should not be re-executed, got %d calls", calls)
+
+	// 熔断器拒绝之后 Failtry换一个服务端 不会在熔断的地址上用完重试次数
+	xc = NewXClient(NewMultiServerDiscovery([]string{dead, alive}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBreakerOption(BreakerOption{ConsecutiveFailures: 1, Cooldown: time.Hour})
+	xc.SetFailOption(FailOption{Mode: Failtry, Retries: 2})
+	for i := 0; i < 2; i++ {
+		err = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "failtry should leave an open breaker: %v", err)
+	}
+
+	// 请求发出后连接断开 服务端可能已经处理 默认不重试
+	_assert(!defaultRetryable(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)), "connection loss after send should not be retried")
+	_assert(defaultRetryable(client.ErrShutdown) && defaultRetryable(ErrBreakerOpen), "explicit Unavailable should be retried")
+}
+
+func TestHedge(t *testing.T) {
+	slowFoo, fastFoo := Foo(500), Foo(0)
+	slow, s1 := startServer(t, &slowFoo)
+	defer func() { _ = s1.Close() }()
+	fast, s2 := startServer(t, &fastFoo)
+	defer func() { _ = s2.Close() }()
+	xc := NewXClient(NewMultiServerDiscovery([]string{slow, fast}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy("Foo.Wait", HedgePolicy{MaxAttempts: 2, Delay: 20 * time.Millisecond})
+
+	// 慢的服务端没有及时回复时 另一份请求发给快的服务端
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Wait", &Args{Num2: i}, &reply)
+		_assert(err == nil && reply == i, "hedged call failed: %v", err)
+		_assert(time.Since(start) < 300*time.Millisecond, "hedged call took %v", time.Since(start))
+	}
+	// 输掉的请求会被取消
+	time.Sleep(50 * time.Millisecond)
+	_assert(xc.Stats().Get(slow).Outstanding() == 0, "slow calls should be canceled")
+	err := xc.Call(context.Background(), "Foo.Wait", &Args{}, nil)
+	_assert(status.CodeOf(err) == status.InvalidArgument, "expect invalid argument for nil reply, got %v", err)
+
+	// 对冲的请求返回不能重试的错误时 仍然等待已经发出的请求
+	d := NewMultiServerDiscovery([]string{slow, fast})
+	d.index = 0
+	xc = NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy("Foo.Reject", HedgePolicy{MaxAttempts: 2, Delay: 20 * time.Millisecond})
+	var reply int
+	err = xc.Call(context.Background(), "Foo.Reject", &Args{Num2: 1}, &reply)
+	_assert(err == nil && reply == 501, "pending attempt should still win: %v", err)
+
+	// 只有一个服务端时不会重复发送同一个请求
+	xc = NewXClient(NewMultiServerDiscovery([]string{slow}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy("Foo.Wait", HedgePolicy{MaxAttempts: 3, Delay: 20 * time.Millisecond})
+	err = xc.Call(context.Background(), "Foo.Wait", &Args{Num2: 1}, &reply)
+	calls, _ := xc.Stats().Get(slow).Counts()
+	_assert(err == nil && reply == 501 && calls == 1, "expect a single attempt, got %d calls %v", calls, err)
+}
+
+func TestBroadcast(t *testing.T) {
+	slowFoo, fastFoo := Foo(300), Foo(0)
+	slow, s1 := startServer(t, &slowFoo)
+	defer func() { _ = s1.Close() }()
+	fast1, s2 := startServer(t, &fastFoo)
+	defer func() { _ = s2.Close() }()
+	fast2, s3 := startServer(t, &fastFoo)
+	defer func() { _ = s3.Close() }()
+	xc := NewXClient(NewMultiServerDiscovery([]string{slow, fast1, fast2}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	t.Run("fork", func(t *testing.T) {
+		start := time.Now()
+		var reply int
+		err := xc.Fork(context.Background(), "Foo.Wait", &Args{Num2: 1}, &reply)
+		_assert(err == nil && reply == 1, "fork failed: %v %d", err, reply)
+		_assert(time.Since(start) < 200*time.Millisecond, "fork should not wait for the slow server")
+	})
+	t.Run("quorum", func(t *testing.T) {
+		// 两个快的服务端回复相同 不需要等待慢的服务端
+		var reply int
+		err := xc.Quorum(context.Background(), 2, "Foo.Wait", &Args{Num2: 2}, &reply)
+		_assert(err == nil && reply == 2, "quorum failed: %v %d", err, reply)
+		err = xc.Quorum(context.Background(), 3, "Foo.Wait", &Args{Num2: 2}, &reply)
+		_assert(status.CodeOf(err) == status.Aborted, "expect aborted, got %v", err)
+		err = xc.Quorum(context.Background(), 4, "Foo.Sum", &Args{Num2: 2}, &reply)
+		_assert(status.CodeOf(err) == status.FailedPrecondition, "expect failed precondition, got %v", err)
+	})
+	t.Run("bad reply", func(t *testing.T) {
+		var reply int
+		_assert(status.CodeOf(xc.Fork(context.Background(), "Foo.Sum", &Args{}, nil)) == status.InvalidArgument, "fork should reject nil reply")
+		_assert(status.CodeOf(xc.Quorum(context.Background(), 2, "Foo.Sum", &Args{}, reply)) == status.InvalidArgument, "quorum should reject non-pointer reply")
+		_, err := xc.Gather(context.Background(), "Foo.Sum", &Args{}, nil)
+		_assert(status.CodeOf(err) == status.InvalidArgument, "gather should reject nil reply")
+	})
+	t.Run("gather", func(t *testing.T) {
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		dead := "tcp@" + l.Addr().String()
+		_ = l.Close()
+		xc := NewXClient(NewMultiServerDiscovery([]string{fast1, dead}), RandomSelect, nil)
+		defer func() { _ = xc.Close() }()
+		results, err := xc.Gather(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, new(int))
+		_assert(err == nil && len(results) == 2, "gather failed: %v", err)
+		_assert(results[0].Addr == fast1 && results[0].Err == nil && *results[0].Reply.(*int) == 3, "unexpected result %+v", results[0])
+		_assert(results[1].Addr == dead && results[1].Err != nil, "dead server should fail")
+	})
+}
+
+func TestBreakerFallback(t *testing.T) {
+	xc := NewXClient(NewMultiServerDiscovery([]string{"tcp@a", "tcp@b", "tcp@c"}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBreakerOption(BreakerOption{ConsecutiveFailures: 1, Cooldown: time.Hour})
+	xc.breaker.fail("tcp@a", false)
+	// a的流量应该分给剩下的服务端 而不是全部给b
+	counts := map[string]int{}
+	for i := 0; i < 120; i++ {
+		addr, err := xc.selectAddr(&PickInfo{}, nil)
+		_assert(err == nil && addr != "tcp@a", "open breaker selected: %s %v", addr, err)
+		counts[addr]++
+	}
+	diff := counts["tcp@b"] - counts["tcp@c"]
+	_assert(diff <= 30 && diff >= -30, "unbalanced fallback %v", counts)
+}
+
+func TestBreaker(t *testing.T) {
+	var foo Foo
+	addr, s := startServer(t, &foo)
+	defer func() { _ = s.Close() }()
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	changes := make(chan BreakerState, 10)
+	xc.SetBreakerOption(BreakerOption{
+		ConsecutiveFailures: 2,
+		Cooldown:            100 * time.Millisecond,
+		OnStateChange: func(addr string, from, to BreakerState) {
+			changes <- to
+		},
+	})
+	timeout := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		var reply int
+		return xc.Call(ctx, "Foo.Sleep", &Args{Num1: 200}, &reply)
+	}
+
+	// 连续超时两次后熔断 之后的调用直接失败
+	_ = timeout()
+	_assert(xc.Breaker(addr) == BreakerClosed, "one failure should not trip the breaker")
+	_ = timeout()
+	_assert(xc.Breaker(addr) == BreakerOpen && <-changes == BreakerOpen, "breaker should be open")
+	var reply int
+	err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1}, &reply)
+	_assert(status.CodeOf(err) == status.Unavailable, "expect unavailable, got %v", err)
+	// 广播不会悄悄跳过熔断的地址
+	results, err := xc.Gather(context.Background(), "Foo.Sum", &Args{Num1: 1}, &reply)
+	_assert(err == nil && len(results) == 1 && results[0].Err == ErrBreakerOpen, "gather should report the open breaker: %v", err)
+
+	// 冷却之后放行一次探测 探测失败重新熔断 成功则恢复
+	time.Sleep(120 * time.Millisecond)
+	_assert(xc.Breaker(addr) == BreakerHalfOpen, "breaker should be half open after cooldown")
+	_ = timeout()
+	_assert(<-changes == BreakerHalfOpen && <-changes == BreakerOpen, "failed probe should reopen the breaker")
+	time.Sleep(120 * time.Millisecond)
+	err = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1}, &reply)
+	_assert(err == nil && reply == 1, "probe failed: %v", err)
+	_assert(<-changes == BreakerHalfOpen && <-changes == BreakerClosed, "successful probe should close the breaker")
+	_assert(xc.Breaker(addr) == BreakerClosed, "breaker should be closed")
+
+	// 被取消的探测不能说明服务端已经恢复 只归还探测名额
+	_ = timeout()
+	_ = timeout()
+	_assert(<-changes == BreakerOpen, "breaker should be open again")
+	time.Sleep(120 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = xc.Call(ctx, "Foo.Sleep", &Args{Num1: 200}, &reply)
+	_assert(status.CodeOf(err) == status.Canceled && <-changes == BreakerHalfOpen, "expect a canceled probe, got %v", err)
+	_assert(xc.Breaker(addr) == BreakerHalfOpen && xc.breaker.ready(addr), "canceled probe should release its slot without closing the breaker")
+}
+
+func TestHealth(t *testing.T) {
+	var foo Foo
+	good, s1 := startServer(t, &foo)
+	defer func() { _ = s1.Close() }()
+	bad, s2 := startServer(t, &foo)
+	defer func() { _ = s2.Close() }()
+	s2.Health.SetServingStatus("", health.NotServing)
+	// 旧版本的服务端没有健康检查服务 不能因此被摘除
+	legacy, s3 := startServer(t, &foo)
+	defer func() { _ = s3.Close() }()
+	s3.ServiceMap.Delete(health.ServiceName)
+	xc := NewXClient(NewMultiServerDiscovery([]string{good, bad, legacy}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	opt := HealthOption{
+		Interval:     20 * time.Millisecond,
+		Timeout:      100 * time.Millisecond,
+		BaseEjection: 200 * time.Millisecond,
+		MaxEjection:  time.Second,
+	}
+	// 关闭再打开不会启动第二个检查协程
+	xc.SetHealthOption(opt)
+	xc.SetHealthOption(HealthOption{})
+	xc.SetHealthOption(opt)
+
+	// 健康检查失败的地址被摘除 调用只会发给健康的服务端
+	time.Sleep(100 * time.Millisecond)
+	ejected := xc.Ejected()
+	_assert(len(ejected) == 1 && ejected[0].Addr == bad && ejected[0].Count == 1, "bad server should be ejected: %+v", ejected)
+	for i := 0; i < 10; i++ {
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: i}, &reply)
+		_assert(err == nil && reply == i, "call failed: %v", err)
+	}
+	calls, _ := xc.Stats().Get(bad).Counts()
+	_assert(calls == 0, "ejected server should not be selected")
+
+	// 摘除到期后检查仍然失败 摘除的时长翻倍
+	time.Sleep(250 * time.Millisecond)
+	ejected = xc.Ejected()
+	_assert(len(ejected) == 1 && ejected[0].Count == 2, "bad server should be ejected again: %+v", ejected)
+	_assert(time.Until(ejected[0].Until) > 200*time.Millisecond, "ejection should back off")
+}